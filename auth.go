@@ -0,0 +1,94 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errInvalidAuth = errors.New("invalid auth")
+
+// Auth is the authentication of the requests to an endpoint.
+type Auth struct {
+	// Headers sent with every request, e.g. an API key.
+	Headers http.Header
+
+	// HTTP basic authentication, used if Username is not empty.
+	Username string
+	Password string
+
+	// Secret of the HS256 JWT authentication used by the engine API. A
+	// token with a fresh 'iat' claim is sent with every request.
+	JWTSecret []byte
+}
+
+func (a *Auth) validate() error {
+	// Both of them are sent in the Authorization header.
+	if a.Username != "" && len(a.JWTSecret) != 0 {
+		return errInvalidAuth
+	}
+	return nil
+}
+
+func (a *Auth) options() []rpc.ClientOption {
+	var opts []rpc.ClientOption
+
+	if len(a.Headers) != 0 {
+		opts = append(opts, rpc.WithHeaders(a.Headers))
+	}
+
+	switch {
+	case a.Username != "":
+		opts = append(opts, rpc.WithHTTPAuth(func(h http.Header) error {
+			req := http.Request{Header: h}
+			req.SetBasicAuth(a.Username, a.Password)
+			return nil
+		}))
+
+	case len(a.JWTSecret) != 0:
+		opts = append(opts, rpc.WithHTTPAuth(func(h http.Header) error {
+			token, err := newJWT(a.JWTSecret, time.Now())
+			if err != nil {
+				return err
+			}
+			h.Set("Authorization", "Bearer "+token)
+			return nil
+		}))
+	}
+
+	return opts
+}
+
+// newJWT returns an HS256 token whose only claim is 'iat'.
+func newJWT(secret []byte, iat time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]int64{"iat": iat.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		enc     = base64.RawURLEncoding
+		payload = enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+		mac     = hmac.New(sha256.New, secret)
+	)
+
+	mac.Write([]byte(payload))
+
+	return payload + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
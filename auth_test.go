@@ -0,0 +1,145 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyJWT checks the HS256 signature and returns the 'iat' claim.
+func verifyJWT(secret []byte, token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed token")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return time.Time{}, errors.New("invalid signature")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var claims struct {
+		Iat int64 `json:"iat"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(claims.Iat, 0), nil
+}
+
+func TestNewJWT(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	iat := time.Unix(1677196800, 0)
+
+	token, err := newJWT(secret, iat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := verifyJWT(secret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(iat) {
+		t.Fatalf("TestNewJWT: want %v got %v", iat, got)
+	}
+
+	if _, err := verifyJWT([]byte("dbadoy"), token); err == nil {
+		t.Fatal("TestNewJWT: token is verified with a wrong secret")
+	}
+}
+
+func TestAuthValidation(t *testing.T) {
+	auth := &Auth{Username: "dbadoy", JWTSecret: []byte("secret")}
+	if err := auth.validate(); !errors.Is(err, errInvalidAuth) {
+		t.Fatalf("TestAuthValidation: want %v got %v", errInvalidAuth, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	requireAuth := func(check func(r *http.Request) bool) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !check(r) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	var (
+		header = requireAuth(func(r *http.Request) bool {
+			return r.Header.Get("X-Api-Key") == "dbadoy"
+		})
+		basic = requireAuth(func(r *http.Request) bool {
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "dbadoy" && pass == "redgla"
+		})
+		jwt = requireAuth(func(r *http.Request) bool {
+			iat, err := verifyJWT(secret, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			return err == nil && time.Since(iat) < time.Minute
+		})
+	)
+
+	cfg := DefaultConfig()
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, header), Auth: &Auth{Headers: http.Header{"X-Api-Key": {"dbadoy"}}}},
+		{URL: newTestNode(t, testBackend{}, basic), Auth: &Auth{Username: "dbadoy", Password: "redgla"}},
+		{URL: newTestNode(t, testBackend{}, jwt), Auth: &Auth{JWTSecret: secret}},
+	}
+
+	r, err := New(DefaultHeartbeatFn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Run()
+	defer r.Stop()
+
+	// The heartbeat passes the authentication.
+	for i := 0; len(r.list.liveNodes()) != len(cfg.EndpointConfigs); i++ {
+		if i == 100 {
+			t.Fatalf("TestAuth: want %v got %v", len(cfg.EndpointConfigs), len(r.list.liveNodes()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// And so do the requests.
+	for _, endpoint := range cfg.EndpointConfigs {
+		res := r.request([]EndpointConfig{r.endpoint(endpoint.URL)}, [2]int{0, 3}, r.fetchBlocks(makeRange(0, 2)), nil)
+		if res.err != nil {
+			t.Fatalf("TestAuth: %s: %v", endpoint.URL, res.err)
+		}
+	}
+
+	// Without the settings, the node refuses.
+	if err := DefaultHeartbeatFn(context.Background(), cfg.EndpointConfigs[2].URL); err == nil {
+		t.Fatal("TestAuth: the request without authentication succeeded")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // HeartbeatFn is a method that can check whether the endpoint is working
@@ -21,7 +22,7 @@ type HeartbeatFn func(ctx context.Context, endpoint string) error
 
 func DefaultHeartbeatFn(ctx context.Context, endpoint string) error {
 	// context.WithTimeout has no effect on DialContext.
-	client, err := ethclient.DialContext(ctx, endpoint)
+	client, err := DialContext(ctx, endpoint)
 	if err != nil {
 		return err
 	}
@@ -31,12 +32,32 @@ func DefaultHeartbeatFn(ctx context.Context, endpoint string) error {
 	return err
 }
 
+type dialOptionsKey struct{}
+
+// DialContext connects a client to the endpoint. Given the context of a
+// HeartbeatFn, it applies the settings of the endpoint such as Auth,
+// its rate limit and its quota, which a HeartbeatFn should use instead
+// of ethclient.DialContext.
+func DialContext(ctx context.Context, endpoint string) (*ethclient.Client, error) {
+	client, err := dialRPC(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return ethclient.NewClient(client), nil
+}
+
+func dialRPC(ctx context.Context, endpoint string) (*rpc.Client, error) {
+	opts, _ := ctx.Value(dialOptionsKey{}).([]rpc.ClientOption)
+	return rpc.DialOptions(ctx, endpoint, opts...)
+}
+
 // Beater manages the status list by examining whether the endpoints
 // registered in the list are operating normally. The endpoint should be
 // URL format.
 type beater struct {
 	name      string
-	endpoints []string
+	endpoints []EndpointConfig
 
 	mu sync.RWMutex
 
@@ -45,10 +66,22 @@ type beater struct {
 	// https://github.com/dbadoy/redgla/pull/3
 	members priorityQueue
 
+	// Block heights reported by the live members along with their
+	// heartbeats, if track is set.
+	heights map[string]heights
+	track   func(ctx context.Context, endpoint string) heights
+
+	// Options the HeartbeatFn dials the endpoints with, see DialContext.
+	dialOptions func(endpoint EndpointConfig) []rpc.ClientOption
+
 	quit chan struct{}
 
 	fn HeartbeatFn
 
+	// Endpoints backing off are considered not alive. Heartbeats dialed
+	// with DialContext count towards the rate limit of the endpoints.
+	throttle *throttle
+
 	interval time.Duration
 	timeout  time.Duration
 }
@@ -56,22 +89,31 @@ type beater struct {
 type message struct {
 	endpoint string
 	spent    time.Duration
+	heights  heights
 }
 
-func newBeater(name string, endpoints []string, fn HeartbeatFn, interval, timeout time.Duration) (*beater, error) {
+// heights is the head, safe and finalized block number reported by a
+// node, keyed by their tags. Tags the node doesn't know are missing.
+type heights map[rpc.BlockNumber]uint64
+
+var trackedTags = []rpc.BlockNumber{rpc.LatestBlockNumber, rpc.SafeBlockNumber, rpc.FinalizedBlockNumber}
+
+func newBeater(name string, endpoints []EndpointConfig, fn HeartbeatFn, throttle *throttle, interval, timeout time.Duration) (*beater, error) {
 	for _, endpoint := range endpoints {
-		if err := isValidEndpoint(endpoint); err != nil {
+		if err := endpoint.validate(); err != nil {
 			return nil, err
 		}
 	}
 
 	return &beater{
-		name:      name,
-		endpoints: endpoints,
-		quit:      make(chan struct{}),
-		fn:        fn,
-		interval:  interval,
-		timeout:   timeout,
+		name:        name,
+		endpoints:   endpoints,
+		dialOptions: func(e EndpointConfig) []rpc.ClientOption { return e.dialOptions() },
+		quit:        make(chan struct{}),
+		fn:          fn,
+		throttle:    throttle,
+		interval:    interval,
+		timeout:     timeout,
 	}, nil
 }
 
@@ -81,7 +123,11 @@ func (b *beater) run() {
 
 func (b *beater) stop() {
 	b.quit <- struct{}{}
+
+	b.mu.Lock()
 	b.members = make(priorityQueue, 0)
+	b.heights = nil
+	b.mu.Unlock()
 }
 
 func (b *beater) loop() {
@@ -92,17 +138,20 @@ func (b *beater) loop() {
 		select {
 		case <-timer.C:
 			var (
-				result = b.beat(b.endpoints)
-				heap   = make(priorityQueue, 0)
+				result  = b.beat(b.nodes())
+				heap    = make(priorityQueue, 0)
+				heights = make(map[string]heights, len(result))
 			)
 
-			for member, spent := range result {
-				heap.add(member, spent)
+			for member, msg := range result {
+				heap.add(member, msg.spent)
+				heights[member] = msg.heights
 			}
 
 			b.mu.Lock()
 			// TODO(dbadoy): We need to find a better way than reallocating every time.
 			b.members = heap
+			b.heights = heights
 			b.mu.Unlock()
 
 			timer.Reset(b.interval)
@@ -113,7 +162,7 @@ func (b *beater) loop() {
 	}
 }
 
-func (b *beater) beat(endpoints []string) map[string]time.Duration {
+func (b *beater) beat(endpoints []EndpointConfig) map[string]*message {
 	resc := make(chan *message, len(endpoints))
 
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
@@ -121,59 +170,77 @@ func (b *beater) beat(endpoints []string) map[string]time.Duration {
 
 	start := time.Now()
 	for _, endpoint := range endpoints {
-		go func(t string) {
+		go func(t string, opts []rpc.ClientOption) {
+			ctx := context.WithValue(ctx, dialOptionsKey{}, opts)
+
+			if b.throttle.throttled(t) {
+				resc <- nil
+				return
+			}
+
 			if err := b.fn(ctx, t); err != nil {
 				resc <- nil
 				return
 			}
-			resc <- &message{t, time.Since(start)}
-		}(endpoint)
+			spent := time.Since(start)
+
+			var heights heights
+			if b.track != nil {
+				heights = b.track(ctx, t)
+			}
+
+			resc <- &message{t, spent, heights}
+		}(endpoint.URL, b.dialOptions(endpoint))
 	}
 
-	m := make(map[string]time.Duration)
+	m := make(map[string]*message)
 
 	for i := 0; i < cap(resc); i++ {
 		msg := <-resc
 		if msg != nil {
-			m[msg.endpoint] = msg.spent
+			m[msg.endpoint] = msg
 		}
 	}
 
 	return m
 }
 
-func (b *beater) add(endpoint string) error {
-	if err := isValidEndpoint(endpoint); err != nil {
+func (b *beater) add(endpoint EndpointConfig) error {
+	if err := endpoint.validate(); err != nil {
 		return err
 	}
 
-	for _, node := range b.nodes() {
-		if node == endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, node := range b.endpoints {
+		if node.URL == endpoint.URL {
 			return errors.New("already exist")
 		}
+		if node.name() == endpoint.name() {
+			return errors.New("name already exist")
+		}
 	}
 
-	b.mu.Lock()
 	b.endpoints = append(b.endpoints, endpoint)
-	b.mu.Unlock()
 
 	return nil
 }
 
+// delete removes the endpoint given by its URL or name.
 func (b *beater) delete(endpoint string) error {
-	if err := isValidEndpoint(endpoint); err != nil {
-		return err
-	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	for i, node := range b.nodes() {
+	for i, node := range b.endpoints {
 		// We don't need to delete a node and remove it
 		// from 'b.members'; add/delete nodes means
 		// applying them in the next 'p.beat'.
-		if node == endpoint {
-			b.mu.Lock()
-			b.endpoints[i] = b.endpoints[len(b.endpoints)-1]
-			b.endpoints = b.endpoints[:len(b.endpoints)-1]
-			b.mu.Unlock()
+		if node.URL == endpoint || node.name() == endpoint {
+			// Copy on write, the heartbeat may be reading the list.
+			endpoints := make([]EndpointConfig, 0, len(b.endpoints)-1)
+			endpoints = append(endpoints, b.endpoints[:i]...)
+			b.endpoints = append(endpoints, b.endpoints[i+1:]...)
 
 			return nil
 		}
@@ -182,13 +249,23 @@ func (b *beater) delete(endpoint string) error {
 	return errors.New("not exist endpoint")
 }
 
-func (b *beater) nodes() []string {
+func (b *beater) nodes() []EndpointConfig {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
 	return b.endpoints
 }
 
+// config returns the configuration of the endpoint.
+func (b *beater) config(endpoint string) (EndpointConfig, bool) {
+	for _, node := range b.nodes() {
+		if node.URL == endpoint {
+			return node, true
+		}
+	}
+	return EndpointConfig{}, false
+}
+
 // The result isn't fully sorted, but it's clear that
 // the first value is the highest priority. What we
 // want is the fastest first item, so we just use it.
@@ -198,3 +275,33 @@ func (b *beater) liveNodes() []string {
 
 	return b.members.keys()
 }
+
+// liveMembers returns a copy of the live nodes along with their
+// heartbeat response time.
+func (b *beater) liveMembers() []item {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return append([]item(nil), b.members...)
+}
+
+// height returns the lowest block number of the tag reported by the live
+// nodes, so that every live node has the block.
+func (b *beater) height(tag rpc.BlockNumber) (uint64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var (
+		res   uint64
+		found bool
+	)
+
+	for _, member := range b.members {
+		n, ok := b.heights[member.key][tag]
+		if ok && (!found || n < res) {
+			res, found = n, true
+		}
+	}
+
+	return res, found
+}
@@ -62,7 +62,7 @@ func TestBeat(t *testing.T) {
 		return nil
 	}
 
-	beater, err := newBeater("test", []string{"http://127.0.0.1:1823", "http://127.0.0.1:1824"}, fn, time.Second, time.Second)
+	beater, err := newBeater("test", []EndpointConfig{{URL: "http://127.0.0.1:1823"}, {URL: "http://127.0.0.1:1824"}}, fn, newThrottle(nil), time.Second, time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,7 +79,7 @@ func TestBeaterWithAlwaysSuccess(t *testing.T) {
 		return nil
 	}
 
-	beater, err := newBeater("test", []string{"http://127.0.0.1:1823", "http://127.0.0.1:1824"}, fn, time.Second, time.Second)
+	beater, err := newBeater("test", []EndpointConfig{{URL: "http://127.0.0.1:1823"}, {URL: "http://127.0.0.1:1824"}}, fn, newThrottle(nil), time.Second, time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -105,7 +105,7 @@ func TestBeaterWithAlwaysFail(t *testing.T) {
 		return errors.New("no")
 	}
 
-	beater, err := newBeater("test", []string{"http://127.0.0.1:1823", "http://127.0.0.1:1824"}, fn, time.Second, time.Second)
+	beater, err := newBeater("test", []EndpointConfig{{URL: "http://127.0.0.1:1823"}, {URL: "http://127.0.0.1:1824"}}, fn, newThrottle(nil), time.Second, time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,247 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TransactionIndex is the position of a transaction in a block.
+type TransactionIndex struct {
+	Block uint64
+	Index uint
+}
+
+// UnclesByRange requests the uncles of the blocks in a range, keyed by
+// the block number. Blocks without uncles have an empty list. Requests
+// of more blocks than the Threshold are split over the live nodes.
+func (r *Redgla) UnclesByRange(start uint64, end uint64) (map[uint64][]*types.Header, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		result  = make(map[uint64][]*types.Header, len(numbers))
+	)
+
+	if len(numbers) == 0 {
+		return result, nil
+	}
+
+	keys := make([]cacheKey, len(numbers))
+	for i, n := range numbers {
+		keys[i] = cacheKey{kind: kindUncles, number: n}
+	}
+
+	// Concurrent callers share the request of each block.
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		numbers := make([]uint64, 0, len(own))
+		for _, i := range own {
+			numbers = append(numbers, keys[i].number)
+		}
+
+		fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+			res := make(map[uint64][]*types.Header, hi-lo)
+			err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) (err error) {
+				res[numbers[i]], err = unclesByNumber(ctx, client, numbers[i])
+				return err
+			})
+			return res, err
+		}
+
+		res := make(map[cacheKey]interface{}, len(numbers))
+
+		err := r.collect("eth_getUncleByBlockNumberAndIndex", len(numbers), true, fn, func(m *msg) {
+			for k, v := range m.uncleResponse() {
+				res[cacheKey{kind: kindUncles, number: k}] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range fetched {
+		result[k.number] = v.([]*types.Header)
+	}
+
+	return result, nil
+}
+
+func unclesByNumber(ctx context.Context, client *conn, number uint64) ([]*types.Header, error) {
+	var count *hexutil.Uint
+	if err := client.rpc.CallContext(ctx, &count, "eth_getUncleCountByBlockNumber", hexutil.EncodeUint64(number)); err != nil {
+		return nil, err
+	}
+	if count == nil {
+		return nil, fmt.Errorf("block %d: %w", number, ethereum.NotFound)
+	}
+
+	uncles := make([]*types.Header, 0, *count)
+	for i := uint(0); i < uint(*count); i++ {
+		var uncle *types.Header
+		if err := client.rpc.CallContext(ctx, &uncle, "eth_getUncleByBlockNumberAndIndex", hexutil.EncodeUint64(number), hexutil.Uint(i)); err != nil {
+			return nil, err
+		}
+		if uncle == nil {
+			return nil, fmt.Errorf("uncle %d of block %d: %w", i, number, ethereum.NotFound)
+		}
+		uncles = append(uncles, uncle)
+	}
+
+	return uncles, nil
+}
+
+// TransactionCountsByBlockRange requests the number of transactions of
+// the blocks in a range, keyed by the block number. Requests of more
+// blocks than the Threshold are split over the live nodes.
+func (r *Redgla) TransactionCountsByBlockRange(start uint64, end uint64) (map[uint64]uint, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		result  = make(map[uint64]uint, len(numbers))
+	)
+
+	if len(numbers) == 0 {
+		return result, nil
+	}
+
+	keys := make([]cacheKey, len(numbers))
+	for i, n := range numbers {
+		keys[i] = cacheKey{kind: kindTransactionCount, number: n}
+	}
+
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		numbers := make([]uint64, 0, len(own))
+		for _, i := range own {
+			numbers = append(numbers, keys[i].number)
+		}
+
+		fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+			res := make(map[uint64]uint, hi-lo)
+			err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) error {
+				var count *hexutil.Uint
+				if err := client.rpc.CallContext(ctx, &count, "eth_getBlockTransactionCountByNumber", hexutil.EncodeUint64(numbers[i])); err != nil {
+					return err
+				}
+				if count == nil {
+					return fmt.Errorf("block %d: %w", numbers[i], ethereum.NotFound)
+				}
+				res[numbers[i]] = uint(*count)
+				return nil
+			})
+			return res, err
+		}
+
+		res := make(map[cacheKey]interface{}, len(numbers))
+
+		err := r.collect("eth_getBlockTransactionCountByNumber", len(numbers), true, fn, func(m *msg) {
+			for k, v := range m.countResponse() {
+				res[cacheKey{kind: kindTransactionCount, number: k}] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range fetched {
+		result[k.number] = v.(uint)
+	}
+
+	return result, nil
+}
+
+// TransactionsByBlockAndIndex requests the transactions at the positions.
+// Requests of more transactions than the Threshold are split over the
+// live nodes.
+func (r *Redgla) TransactionsByBlockAndIndex(indices []TransactionIndex) (map[TransactionIndex]*types.Transaction, error) {
+	var (
+		seen   = make(map[TransactionIndex]bool, len(indices))
+		unique = make([]TransactionIndex, 0, len(indices))
+	)
+
+	for _, index := range indices {
+		if !seen[index] {
+			seen[index] = true
+			unique = append(unique, index)
+		}
+	}
+
+	result := make(map[TransactionIndex]*types.Transaction, len(unique))
+	if len(unique) == 0 {
+		return result, nil
+	}
+
+	keys := make([]cacheKey, len(unique))
+	for i, index := range unique {
+		keys[i] = cacheKey{kind: kindIndexedTransaction, number: index.Block, index: index.Index}
+	}
+
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		pending := make([]TransactionIndex, 0, len(own))
+		for _, i := range own {
+			pending = append(pending, unique[i])
+		}
+
+		fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+			res := make(map[int]*types.Transaction, hi-lo)
+			err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) error {
+				var tx *types.Transaction
+				if err := client.rpc.CallContext(ctx, &tx, "eth_getTransactionByBlockNumberAndIndex", hexutil.EncodeUint64(pending[i].Block), hexutil.Uint(pending[i].Index)); err != nil {
+					return err
+				}
+				if tx == nil {
+					return fmt.Errorf("transaction %d of block %d: %w", pending[i].Index, pending[i].Block, ethereum.NotFound)
+				}
+				res[i] = tx
+				return nil
+			})
+			return res, err
+		}
+
+		res := make(map[cacheKey]interface{}, len(pending))
+
+		err := r.collect("eth_getTransactionByBlockNumberAndIndex", len(pending), true, fn, func(m *msg) {
+			for k, v := range m.indexedTransactionResponse() {
+				res[cacheKey{kind: kindIndexedTransaction, number: pending[k].Block, index: pending[k].Index}] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range fetched {
+		result[TransactionIndex{k.number, k.index}] = v.(*types.Transaction)
+	}
+
+	return result, nil
+}
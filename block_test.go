@@ -0,0 +1,147 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// GetUncleCountByBlockNumber returns the block number modulo 3.
+func (testBackend) GetUncleCountByBlockNumber(number rpc.BlockNumber) *hexutil.Uint {
+	count := hexutil.Uint(testNumber(number) % 3)
+	return &count
+}
+
+// GetUncleByBlockNumberAndIndex returns the uncle whose extra data is its
+// index.
+func (testBackend) GetUncleByBlockNumberAndIndex(number rpc.BlockNumber, index hexutil.Uint) (*types.Header, error) {
+	if uint64(index) >= testNumber(number)%3 {
+		return nil, nil
+	}
+
+	header := testHeader(testNumber(number) - 1)
+	header.Extra = []byte{byte(index)}
+
+	return header, nil
+}
+
+// GetBlockTransactionCountByNumber returns the block number modulo 7.
+func (testBackend) GetBlockTransactionCountByNumber(number rpc.BlockNumber) *hexutil.Uint {
+	count := hexutil.Uint(testNumber(number) % 7)
+	return &count
+}
+
+// GetTransactionByBlockNumberAndIndex returns the transaction of the
+// block number times 100 plus the index as the nonce, for the indices
+// below 5.
+func (testBackend) GetTransactionByBlockNumberAndIndex(number rpc.BlockNumber, index hexutil.Uint) *types.Transaction {
+	if index >= 5 {
+		return nil
+	}
+	return testIndexedTransaction(testNumber(number), uint(index))
+}
+
+func testIndexedTransaction(number uint64, index uint) *types.Transaction {
+	return types.NewTransaction(number*100+uint64(index), common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+}
+
+func TestUnclesByRange(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.UnclesByRange(1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 20 {
+		t.Fatalf("TestUnclesByRange: want %v got %v", 20, len(res))
+	}
+	for n, uncles := range res {
+		if len(uncles) != int(n%3) {
+			t.Fatalf("TestUnclesByRange: want %v got %v", n%3, len(uncles))
+		}
+		for i, uncle := range uncles {
+			if uncle.Number.Uint64() != n-1 || uncle.Extra[0] != byte(i) {
+				t.Fatalf("TestUnclesByRange: want %v got %v", []uint64{n - 1, uint64(i)}, []uint64{uncle.Number.Uint64(), uint64(uncle.Extra[0])})
+			}
+		}
+	}
+}
+
+func TestTransactionCountsByBlockRange(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.TransactionCountsByBlockRange(1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 20 {
+		t.Fatalf("TestTransactionCountsByBlockRange: want %v got %v", 20, len(res))
+	}
+	for n, count := range res {
+		if count != uint(n%7) {
+			t.Fatalf("TestTransactionCountsByBlockRange: want %v got %v", n%7, count)
+		}
+	}
+}
+
+func TestTransactionsByBlockAndIndex(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	var indices []TransactionIndex
+	for n := uint64(1); n <= 4; n++ {
+		for i := uint(0); i < 5; i++ {
+			indices = append(indices, TransactionIndex{n, i})
+		}
+	}
+
+	res, err := r.TransactionsByBlockAndIndex(append(indices, indices[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(indices) {
+		t.Fatalf("TestTransactionsByBlockAndIndex: want %v got %v", len(indices), len(res))
+	}
+	for _, index := range indices {
+		want := testIndexedTransaction(index.Block, index.Index)
+		if res[index].Hash() != want.Hash() {
+			t.Fatalf("TestTransactionsByBlockAndIndex: want %v got %v", want.Hash(), res[index].Hash())
+		}
+	}
+
+	_, err = r.TransactionsByBlockAndIndex([]TransactionIndex{{1, 5}})
+	if !errors.Is(err, ethereum.NotFound) {
+		t.Fatalf("TestTransactionsByBlockAndIndex: want %v got %v", ethereum.NotFound, err)
+	}
+}
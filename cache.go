@@ -0,0 +1,268 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Blocks this deep below the head are considered final unless
+// CacheConfig.FinalityDepth says otherwise.
+const defaultFinalityDepth = 64
+
+var errInvalidCache = errors.New("invalid cache config")
+
+// CacheConfig is the configuration of the in-memory cache of immutable
+// chain data; blocks and receipts below the finality depth, and
+// transactions.
+type CacheConfig struct {
+	// Maximum number of cached items. If zero, it is unlimited.
+	MaxEntries int
+
+	// Maximum approximate size of the cached items. If zero, it is
+	// unlimited.
+	MaxBytes int64
+
+	// Number of blocks below the head after which a block can no longer
+	// be reorged out. If zero, it is 64.
+	FinalityDepth uint64
+}
+
+func (c *CacheConfig) validate() error {
+	if c.MaxEntries < 0 || c.MaxBytes < 0 {
+		return errInvalidCache
+	}
+
+	// At least one bound is needed, or the cache grows forever.
+	if c.MaxEntries == 0 && c.MaxBytes == 0 {
+		return errInvalidCache
+	}
+
+	return nil
+}
+
+func (c *CacheConfig) finalityDepth() uint64 {
+	if c.FinalityDepth == 0 {
+		return defaultFinalityDepth
+	}
+	return c.FinalityDepth
+}
+
+// CacheStats is a snapshot of the cache counters.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+
+	Entries int
+	Bytes   int64
+}
+
+const (
+	kindBlock byte = iota
+	kindTransaction
+	kindReceipt
+
+	// Only shared by the flights, never cached.
+	kindUncles
+	kindTransactionCount
+	kindIndexedTransaction
+	kindBalance
+	kindNonce
+)
+
+type cacheKey struct {
+	kind    byte
+	number  uint64
+	hash    common.Hash
+	index   uint
+	address common.Address
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	v    interface{}
+	size int64
+}
+
+// cache is an LRU cache bounded by the number and size of its items. A
+// nil cache is disabled; it misses every lookup and ignores additions.
+type cache struct {
+	mu sync.Mutex
+
+	cfg   CacheConfig
+	ll    *list.List
+	items map[cacheKey]*list.Element
+	bytes int64
+
+	hits   uint64
+	misses uint64
+}
+
+func newCache(cfg *CacheConfig) *cache {
+	if cfg == nil {
+		return nil
+	}
+
+	return &cache{
+		cfg:   *cfg,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *cache) get(key cacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.ll.MoveToFront(e)
+
+	return e.Value.(*cacheEntry).v, true
+}
+
+func (c *cache) add(key cacheKey, v interface{}, size int64) {
+	// Never fits, and would flush everything else.
+	if c.cfg.MaxBytes != 0 && size > c.cfg.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, v, size})
+	c.bytes += size
+
+	for c.overflow() {
+		c.evict()
+	}
+}
+
+func (c *cache) overflow() bool {
+	if c.cfg.MaxEntries != 0 && c.ll.Len() > c.cfg.MaxEntries {
+		return true
+	}
+	return c.cfg.MaxBytes != 0 && c.bytes > c.cfg.MaxBytes
+}
+
+func (c *cache) evict() {
+	e := c.ll.Back()
+	if e == nil {
+		return
+	}
+
+	entry := c.ll.Remove(e).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *cache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.ll.Len(),
+		Bytes:   c.bytes,
+	}
+}
+
+// blocks puts the cached blocks in res and returns the missing numbers.
+func (c *cache) blocks(numbers []uint64, res map[uint64]*types.Block) []uint64 {
+	if c == nil {
+		return numbers
+	}
+
+	misses := make([]uint64, 0, len(numbers))
+	for _, n := range numbers {
+		if v, ok := c.get(cacheKey{kind: kindBlock, number: n}); ok {
+			res[n] = v.(*types.Block)
+			continue
+		}
+		misses = append(misses, n)
+	}
+
+	return misses
+}
+
+func (c *cache) addBlock(block *types.Block) {
+	if c == nil || block == nil {
+		return
+	}
+	c.add(cacheKey{kind: kindBlock, number: block.NumberU64()}, block, int64(block.Size()))
+}
+
+// transactions puts the cached transactions in res and returns the
+// missing hashes.
+func (c *cache) transactions(hashes []common.Hash, res map[common.Hash]*types.Transaction) []common.Hash {
+	if c == nil {
+		return hashes
+	}
+
+	misses := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		if v, ok := c.get(cacheKey{kind: kindTransaction, hash: hash}); ok {
+			res[hash] = v.(*types.Transaction)
+			continue
+		}
+		misses = append(misses, hash)
+	}
+
+	return misses
+}
+
+func (c *cache) addTransaction(tx *types.Transaction) {
+	if c == nil || tx == nil {
+		return
+	}
+	c.add(cacheKey{kind: kindTransaction, hash: tx.Hash()}, tx, int64(tx.Size()))
+}
+
+// receipts puts the cached receipts in res and returns the transactions
+// whose receipt is missing.
+func (c *cache) receipts(txs []*types.Transaction, res map[common.Hash]*types.Receipt) []*types.Transaction {
+	if c == nil {
+		return txs
+	}
+
+	misses := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if v, ok := c.get(cacheKey{kind: kindReceipt, hash: tx.Hash()}); ok {
+			res[tx.Hash()] = v.(*types.Receipt)
+			continue
+		}
+		misses = append(misses, tx)
+	}
+
+	return misses
+}
+
+func (c *cache) addReceipt(hash common.Hash, receipt *types.Receipt) {
+	if c == nil || receipt == nil {
+		return
+	}
+	c.add(cacheKey{kind: kindReceipt, hash: hash}, receipt, int64(receipt.Size()))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(&CacheConfig{MaxEntries: 2})
+
+	for n := uint64(0); n < 3; n++ {
+		c.addBlock(types.NewBlockWithHeader(testHeader(n)))
+	}
+
+	res := make(map[uint64]*types.Block)
+	if misses := c.blocks([]uint64{0, 1, 2}, res); len(misses) != 1 || misses[0] != 0 {
+		t.Fatalf("TestCacheEviction: want %v got %v", []uint64{0}, misses)
+	}
+
+	stats := c.stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 2 {
+		t.Fatalf("TestCacheEviction: want %v got %v", CacheStats{2, 1, 2, stats.Bytes}, stats)
+	}
+
+	// The least recently used block goes first.
+	c.blocks([]uint64{1}, res)
+	c.addBlock(types.NewBlockWithHeader(testHeader(3)))
+	if misses := c.blocks([]uint64{1, 2, 3}, res); len(misses) != 1 || misses[0] != 2 {
+		t.Fatalf("TestCacheEviction: want %v got %v", []uint64{2}, misses)
+	}
+
+	size := int64(types.NewBlockWithHeader(testHeader(0)).Size())
+
+	c = newCache(&CacheConfig{MaxBytes: 2 * size})
+	for n := uint64(0); n < 3; n++ {
+		c.addBlock(types.NewBlockWithHeader(testHeader(n)))
+	}
+	if stats := c.stats(); stats.Entries != 2 || stats.Bytes > 2*size {
+		t.Fatalf("TestCacheEviction: want %v got %v", 2, stats.Entries)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *cache
+
+	c.addBlock(types.NewBlockWithHeader(testHeader(0)))
+	if misses := c.blocks([]uint64{0}, make(map[uint64]*types.Block)); len(misses) != 1 {
+		t.Fatalf("TestNilCache: want %v got %v", 1, len(misses))
+	}
+	if stats := c.stats(); stats != (CacheStats{}) {
+		t.Fatalf("TestNilCache: want %v got %v", CacheStats{}, stats)
+	}
+}
+
+func TestCachedBlockByRange(t *testing.T) {
+	var requests int64
+
+	count := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			atomic.AddInt64(&requests, int64(strings.Count(string(body), "eth_getBlockByNumber")))
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Cache = &CacheConfig{MaxEntries: 100}
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, count),
+		newTestNode(t, testBackend{}, count),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	if _, err := r.BlockByRangeWithBatch(100, 119); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt64(&requests, 0)
+
+	blocks, err := r.BlockByRangeWithBatch(110, 129)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 20 {
+		t.Fatalf("TestCachedBlockByRange: want %v got %v", 20, len(blocks))
+	}
+	for n, block := range blocks {
+		if block.Hash() != testHeader(n).Hash() {
+			t.Fatalf("TestCachedBlockByRange: want %v got %v", testHeader(n).Hash(), block.Hash())
+		}
+	}
+
+	// Only the misses are requested.
+	if got := atomic.LoadInt64(&requests); got != 10 {
+		t.Fatalf("TestCachedBlockByRange: want %v got %v", 10, got)
+	}
+
+	// Blocks within the finality depth are not cached.
+	if _, err := r.BlockByRange(990, 999); err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.CacheStats(); stats.Entries != 30 {
+		t.Fatalf("TestCachedBlockByRange: want %v got %v", 30, stats.Entries)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const defaultMulticallSize = 100
+
+var (
+	// Multicall3Address is the address Multicall3 is deployed at on most
+	// chains.
+	Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+	errInvalidMulticall = errors.New("invalid multicall config")
+)
+
+const multicall3ABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicall3 = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// Multicall is the configuration of the Multicall3 aggregation of
+// CallContracts.
+type Multicall struct {
+	// Address of the Multicall3 contract. If zero, it is
+	// Multicall3Address.
+	Address common.Address
+
+	// Maximum number of calls packed into a single eth_call. If zero, it
+	// is 100.
+	Size int
+}
+
+func (m *Multicall) validate() error {
+	if m.Size < 0 {
+		return errInvalidMulticall
+	}
+	return nil
+}
+
+func (m *Multicall) address() common.Address {
+	if m.Address == (common.Address{}) {
+		return Multicall3Address
+	}
+	return m.Address
+}
+
+func (m *Multicall) size() int {
+	if m.Size == 0 {
+		return defaultMulticallSize
+	}
+	return m.Size
+}
+
+// CallResult is the result of a call of CallContracts.
+type CallResult struct {
+	// Return data of the call.
+	Data []byte
+
+	// Error of the call, a *RevertError if the call reverted.
+	Err error
+}
+
+// RevertError is the error of a reverted call.
+type RevertError struct {
+	// Reason given to revert, if the data is an Error(string).
+	Reason string
+
+	// Revert data returned by the contract.
+	Data []byte
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+func newRevertError(data []byte) *RevertError {
+	reason, _ := abi.UnpackRevert(data)
+	return &RevertError{reason, data}
+}
+
+// call3 is the Multicall3.Call3 struct.
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// result3 is the Multicall3.Result struct.
+type result3 struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// CallContracts executes the calls at the block, the latest one if nil,
+// and returns their results in order. Calls that revert fail on their
+// own; other failures fail the whole request. Requests of more calls
+// than the Threshold are split over the live nodes.
+//
+// If Config.Multicall is set, the calls without From, Value, gas and gas
+// price settings or access list are packed into Multicall3 aggregate3
+// calls, executed as the Multicall3 contract. The others are sent as
+// they are.
+func (r *Redgla) CallContracts(ctx context.Context, calls []ethereum.CallMsg, block *big.Int) ([]CallResult, error) {
+	result := make([]CallResult, len(calls))
+	if len(calls) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		return r.callContracts(ctx, client, calls, block, lo, hi, timeout, quit)
+	}
+
+	err := r.collect("eth_call", len(calls), true, fn, func(m *msg) {
+		for k, v := range m.callResponse() {
+			result[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *Redgla) callContracts(ctx context.Context, client *conn, calls []ethereum.CallMsg, block *big.Int, lo int, hi int, timeout time.Duration, quit chan struct{}) (map[int]CallResult, error) {
+	var (
+		res     = make(map[int]CallResult, hi-lo)
+		packed  []int
+		singles []int
+	)
+
+	for i := lo; i < hi; i++ {
+		if r.cfg.Multicall != nil && packable(calls[i]) {
+			packed = append(packed, i)
+		} else {
+			singles = append(singles, i)
+		}
+	}
+
+	err := forEach(ctx, 0, len(singles), timeout, quit, func(ctx context.Context, k int) error {
+		i := singles[k]
+
+		data, err := client.CallContract(ctx, calls[i], block)
+		if revert, ok := asRevert(err); ok {
+			res[i] = CallResult{Err: revert}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		res[i] = CallResult{Data: data}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(packed) == 0 {
+		return res, nil
+	}
+
+	chunks := splitPart([2]int{0, len(packed)}, r.cfg.Multicall.size())
+
+	err = forEach(ctx, 0, len(chunks), timeout, quit, func(ctx context.Context, k int) error {
+		chunk := packed[chunks[k][0]:chunks[k][1]]
+
+		results, err := multicall(ctx, client, r.cfg.Multicall.address(), calls, chunk, block)
+		if err != nil {
+			return err
+		}
+
+		for j, i := range chunk {
+			res[i] = results[j]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// packable reports whether the call can be executed by Multicall3,
+// which calls without value and with the gas left and the gas price of
+// the aggregate3 call.
+func packable(call ethereum.CallMsg) bool {
+	return call.To != nil && call.From == (common.Address{}) &&
+		(call.Value == nil || call.Value.Sign() == 0) && call.Gas == 0 &&
+		call.GasPrice == nil && call.GasFeeCap == nil && call.GasTipCap == nil &&
+		len(call.AccessList) == 0
+}
+
+// multicall executes the calls of the indices in a single aggregate3
+// call.
+func multicall(ctx context.Context, client *conn, address common.Address, calls []ethereum.CallMsg, indices []int, block *big.Int) ([]CallResult, error) {
+	args := make([]call3, len(indices))
+	for j, i := range indices {
+		args[j] = call3{Target: *calls[i].To, AllowFailure: true, CallData: calls[i].Data}
+	}
+
+	input, err := multicall3.Pack("aggregate3", args)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: input}, block)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := multicall3.Unpack("aggregate3", output)
+	if err != nil {
+		return nil, fmt.Errorf("multicall: %w", err)
+	}
+
+	results := *abi.ConvertType(out[0], new([]result3)).(*[]result3)
+
+	if len(results) != len(indices) {
+		return nil, fmt.Errorf("multicall: %d results for %d calls", len(results), len(indices))
+	}
+
+	res := make([]CallResult, len(results))
+	for j, result := range results {
+		if result.Success {
+			res[j] = CallResult{Data: result.ReturnData}
+		} else {
+			res[j] = CallResult{Err: newRevertError(result.ReturnData)}
+		}
+	}
+
+	return res, nil
+}
+
+// asRevert returns the revert of a call, which the node returns as an
+// error with the code 3 and the revert data. Some nodes answer the
+// reverts without data, e.g. a bare revert(), with a plain "execution
+// reverted" error instead.
+func asRevert(err error) (*RevertError, bool) {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return nil, false
+	}
+
+	var (
+		msg     = rpcErr.Error()
+		dataErr rpc.DataError
+	)
+
+	if errors.As(err, &dataErr) {
+		if s, ok := dataErr.ErrorData().(string); ok {
+			if data, err := hexutil.Decode(s); err == nil && len(data) != 0 {
+				return newRevertError(data), true
+			}
+		}
+	}
+
+	if rpcErr.ErrorCode() != 3 && !strings.HasPrefix(msg, "execution reverted") {
+		return nil, false
+	}
+
+	reason := strings.TrimPrefix(msg, "execution reverted")
+	return &RevertError{Reason: strings.TrimPrefix(reason, ": ")}, true
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type testCallArgs struct {
+	To   *common.Address `json:"to"`
+	Data hexutil.Bytes   `json:"data"`
+}
+
+// testRevertError is the error of a reverted call, as a node returns it.
+type testRevertError struct {
+	data []byte
+}
+
+func (e testRevertError) Error() string          { return "execution reverted" }
+func (e testRevertError) ErrorCode() int         { return 3 }
+func (e testRevertError) ErrorData() interface{} { return hexutil.Encode(e.data) }
+
+// Call echoes the call data, or reverts if it starts with 0xff, without
+// revert data if it starts with 0xfe. Calls to Multicall3Address are
+// aggregate3 calls.
+func (testBackend) Call(args testCallArgs, block rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if args.To == nil || *args.To != Multicall3Address {
+		ret, revert, ok := testCall(args.Data)
+		switch {
+		case ok:
+			return ret, nil
+		case revert == nil:
+			// Like geth, which answers the reverts without data with a
+			// plain error.
+			return nil, errors.New("execution reverted")
+		default:
+			return nil, testRevertError{revert}
+		}
+	}
+
+	method := multicall3.Methods["aggregate3"]
+
+	in, err := method.Inputs.Unpack(args.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	calls := *abi.ConvertType(in[0], new([]call3)).(*[]call3)
+
+	results := make([]result3, len(calls))
+	for i, call := range calls {
+		ret, revert, ok := testCall(call.CallData)
+		if ok {
+			results[i] = result3{true, ret}
+		} else {
+			results[i] = result3{false, revert}
+		}
+	}
+
+	return method.Outputs.Pack(results)
+}
+
+func testCall(data []byte) ([]byte, []byte, bool) {
+	switch {
+	case len(data) != 0 && data[0] == 0xff:
+		return nil, testRevertData("nope"), false
+	case len(data) != 0 && data[0] == 0xfe:
+		return nil, nil, false
+	}
+	return data, nil, true
+}
+
+func testRevertData(reason string) []byte {
+	t, _ := abi.NewType("string", "", nil)
+	b, _ := abi.Arguments{{Type: t}}.Pack(reason)
+	return append(crypto.Keccak256([]byte("Error(string)"))[:4], b...)
+}
+
+func TestCallContracts(t *testing.T) {
+	var calls int64
+
+	count := countMethod("eth_call", &calls)
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, count),
+		newTestNode(t, testBackend{}, count),
+	}
+
+	to := common.HexToAddress("0x01")
+
+	msgs := make([]ethereum.CallMsg, 20)
+	for i := range msgs {
+		msgs[i] = ethereum.CallMsg{To: &to, Data: []byte{byte(i)}}
+	}
+	msgs[7].Data = []byte{0xff}
+	msgs[12].Data = []byte{0xfe}
+
+	check := func(results []CallResult) {
+		for i, res := range results {
+			if i == 7 {
+				var revert *RevertError
+				if !errors.As(res.Err, &revert) || revert.Reason != "nope" {
+					t.Fatalf("TestCallContracts: want %v got %v", "nope", res.Err)
+				}
+				continue
+			}
+			if i == 12 {
+				var revert *RevertError
+				if !errors.As(res.Err, &revert) || revert.Reason != "" {
+					t.Fatalf("TestCallContracts: want %v got %v", &RevertError{}, res.Err)
+				}
+				continue
+			}
+			if res.Err != nil || !bytes.Equal(res.Data, msgs[i].Data) {
+				t.Fatalf("TestCallContracts: want %x got %x (%v)", msgs[i].Data, res.Data, res.Err)
+			}
+		}
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	results, err := r.CallContracts(context.Background(), msgs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(results)
+
+	// The calls are packed into Multicall3 calls of at most 8.
+	cfg.Multicall = &Multicall{Size: 8}
+	atomic.StoreInt64(&calls, 0)
+
+	results, err = r.CallContracts(context.Background(), msgs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(results)
+
+	// The 20 calls are split in two parts of 10, each packed in 2 calls.
+	if got := atomic.LoadInt64(&calls); got != 4 {
+		t.Fatalf("TestCallContracts: want %v got %v", 4, got)
+	}
+}
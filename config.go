@@ -6,10 +6,15 @@
 package redgla
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 const (
@@ -19,18 +24,46 @@ const (
 	defaultHeartbeatTimeout  = time.Second
 )
 
+// Tags of EndpointConfig.Tags that mark the nodes able to serve some
+// requests.
+const (
+	// TagArchive marks the nodes keeping the state of every block. If
+	// any endpoint is tagged, the state of the blocks older than the
+	// last 128 ones is only requested to them.
+	TagArchive = "archive"
+
+	// TagDebug marks the nodes serving the debug namespace. The traces
+	// are only requested to them.
+	TagDebug = "debug"
+
+	// TagTrace marks the nodes serving the trace namespace of
+	// OpenEthereum, e.g. Erigon and Nethermind. TraceFilter is only
+	// requested to them.
+	TagTrace = "trace"
+)
+
 var (
-	errInvalidEndpoint = errors.New("invalid endpoint")
-	errInvalidInterval = errors.New("invalid heartbeat interval")
-	errInvalidTimeout  = errors.New("invalid timeout")
+	errInvalidEndpoint   = errors.New("invalid endpoint")
+	errInvalidInterval   = errors.New("invalid heartbeat interval")
+	errInvalidTimeout    = errors.New("invalid timeout")
+	errInvalidRateLimit  = errors.New("invalid rate limit")
+	errInvalidWeight     = errors.New("invalid weight")
+	errInvalidBatchSize  = errors.New("invalid batch size")
+	errDuplicateEndpoint = errors.New("duplicate endpoint")
+	errDuplicateName     = errors.New("duplicate endpoint name")
 
 	errWebsocketNotSupported = errors.New("websocket not supported")
 )
 
 type Config struct {
-	// A list of endpoints to send batch requests to.
+	// A list of endpoints to send batch requests to. It is the shorthand
+	// of EndpointConfigs for endpoints that only need a URL.
 	Endpoints []string
 
+	// A list of endpoints to send batch requests to, along with their
+	// own settings.
+	EndpointConfigs []EndpointConfig
+
 	// Threshold to send a batch request. If the number of requests is
 	// greater than the value, they are converted to batch requests.
 	Threshold int
@@ -45,6 +78,242 @@ type Config struct {
 
 	// Timeout for requests to determine 'alive'.
 	HeartbeatTimeout time.Duration
+
+	// Timeout of each trace, given to the node as the timeout of its
+	// tracer. Traces take much longer than the other requests, so the
+	// RequestTimeout doesn't apply to them. If zero, it is 10 minutes.
+	TraceTimeout time.Duration
+
+	// Time without a new head after which SubscribeNewHead switches to
+	// another node. If zero, it is 1 minute.
+	HeadTimeout time.Duration
+
+	// Strategy for choosing the node of a single request and the order
+	// of nodes a batch request is split over. If nil, the fastest node
+	// is preferred.
+	Selector Selector
+
+	// Request rate limits keyed by endpoint. Endpoints without an entry
+	// are not limited. Limits apply to every request including the
+	// heartbeat. EndpointConfig.RateLimit takes precedence.
+	RateLimits map[string]RateLimit
+
+	// Budgets keyed by endpoint. Requests are shifted to other nodes
+	// when an endpoint runs out of budget, and refused if no node has
+	// budget left. Endpoints without an entry are not tracked.
+	// EndpointConfig.Quota takes precedence.
+	Quotas map[string]Quota
+
+	// Verify that each block of a range is the parent of the next one.
+	// The blocks near the head may come from nodes on different forks;
+	// those that differ from the majority of the nodes are refetched.
+	// If the chain still can't be assembled, ReorgDetected is returned.
+	CheckParentHash bool
+
+	// Limit the ranges to the finalized block, and cache only the data
+	// of the finalized blocks, so that nothing returned can be reorged
+	// out. Requests fail with ErrUnknownHeight if no live node reports
+	// the finalized block.
+	ClampToFinalized bool
+
+	// Verify the blocks and receipts against the roots of their header,
+	// and the headers against the hash the node reports. A node
+	// returning inconsistent data is left out for a while and the
+	// request is retried on the next node. Verifying receipts also
+	// requests their blocks and the receipts of all their transactions.
+	Verify bool
+
+	// Fetch every item from several nodes and accept it only if enough
+	// of them agree on it. Otherwise a QuorumError names the dissenting
+	// nodes. If nil, each item is fetched from a single node.
+	Quorum *Quorum
+
+	// Pack the calls of CallContracts into Multicall3 calls. If nil,
+	// each call is a separate eth_call.
+	Multicall *Multicall
+
+	// In-memory cache of immutable chain data. Only the items missing
+	// in the cache are requested to the nodes. If nil, nothing is
+	// cached.
+	Cache *CacheConfig
+
+	// On-disk cache of final blocks and receipts, read on the misses
+	// of the memory cache. If nil, nothing is persisted. Call
+	// Redgla.Close to release it.
+	DiskCache *DiskCacheConfig
+}
+
+// EndpointConfig is the configuration of a single endpoint. Only URL is
+// required.
+type EndpointConfig struct {
+	URL string
+
+	// Name of the endpoint shown in errors and results instead of the
+	// URL, which often contains an API key. If empty, the URL without
+	// its credentials, path and query is shown, followed by a short hash
+	// of the URL. Names must be unique.
+	Name string
+
+	// Weight of the endpoint for NewWeightedRandomSelector. If zero, it
+	// is 1.
+	Weight int
+
+	// Request rate limit of the endpoint. See Config.RateLimits.
+	RateLimit *RateLimit
+
+	// Budget of the endpoint. See Config.Quotas.
+	Quota *Quota
+
+	// Timeout of the requests to the endpoint. If zero,
+	// Config.RequestTimeout is used.
+	RequestTimeout time.Duration
+
+	// Free-form labels of the endpoint, passed to the Selector. Some
+	// of them also route requests, see TagArchive.
+	Tags []string
+
+	// Maximum number of items the endpoint is given at once by a batch
+	// request. Larger parts are split further. If zero, it is unlimited.
+	BatchSize int
+
+	// Authentication of the requests to the endpoint, including the
+	// heartbeat of DefaultHeartbeatFn.
+	Auth *Auth
+
+	// TLS settings of the endpoint, including the heartbeat of
+	// DefaultHeartbeatFn.
+	TLS *TLSConfig
+
+	// WebSocket URL of the same node, e.g. "wss://...", only used by
+	// SubscribeNewHead. If empty, SubscribeNewHead polls URL instead.
+	WebSocket string
+}
+
+func (e *EndpointConfig) validate() error {
+	if err := isValidEndpoint(e.URL); err != nil {
+		return err
+	}
+
+	if e.Weight < 0 {
+		return fmt.Errorf("%s: %w", e.name(), errInvalidWeight)
+	}
+
+	if e.BatchSize < 0 {
+		return fmt.Errorf("%s: %w", e.name(), errInvalidBatchSize)
+	}
+
+	if e.RequestTimeout < 0 {
+		return fmt.Errorf("%s: %w", e.name(), errInvalidTimeout)
+	}
+
+	if e.WebSocket != "" {
+		if u, err := url.ParseRequestURI(e.WebSocket); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+			return fmt.Errorf("%s: %w", e.name(), errInvalidEndpoint)
+		}
+	}
+
+	if e.RateLimit != nil {
+		if err := e.RateLimit.validate(); err != nil {
+			return fmt.Errorf("%s: %w", e.name(), err)
+		}
+	}
+
+	if e.Auth != nil {
+		if err := e.Auth.validate(); err != nil {
+			return fmt.Errorf("%s: %w", e.name(), err)
+		}
+	}
+
+	if e.TLS != nil {
+		if err := e.TLS.validate(); err != nil {
+			return fmt.Errorf("%s: %w", e.name(), err)
+		}
+	}
+
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the name of the endpoint that is safe to show.
+func (e *EndpointConfig) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return redactURL(e.URL)
+}
+
+// dialOptions returns the options to dial the endpoint with.
+func (e *EndpointConfig) dialOptions() []rpc.ClientOption {
+	var opts []rpc.ClientOption
+
+	if e.Auth != nil {
+		opts = append(opts, e.Auth.options()...)
+	}
+
+	// The settings are validated, so errors can't happen here.
+	if e.TLS != nil {
+		if dialer, err := e.TLS.websocketDialer(); err == nil {
+			opts = append(opts, rpc.WithWebsocketDialer(dialer))
+		}
+		opts = append(opts, rpc.WithHTTPClient(&http.Client{Transport: e.roundTripper()}))
+	}
+
+	return opts
+}
+
+// roundTripper returns the base HTTP transport of the endpoint.
+func (e *EndpointConfig) roundTripper() http.RoundTripper {
+	if e.TLS != nil {
+		if transport, err := e.TLS.tlsTransport(); err == nil {
+			return transport
+		}
+	}
+	return http.DefaultTransport
+}
+
+// endpoint completes the endpoint configuration with the per-endpoint
+// settings of Config.
+func (c *Config) endpoint(e EndpointConfig) EndpointConfig {
+	if e.RateLimit == nil {
+		if limit, ok := c.RateLimits[e.URL]; ok {
+			e.RateLimit = &limit
+		}
+	}
+
+	if e.Quota == nil {
+		if quota, ok := c.Quotas[e.URL]; ok {
+			e.Quota = &quota
+		}
+	}
+
+	if e.RequestTimeout == 0 {
+		e.RequestTimeout = c.RequestTimeout
+	}
+
+	return e
+}
+
+// endpoints returns all the configured endpoints.
+func (c *Config) endpoints() []EndpointConfig {
+	res := make([]EndpointConfig, 0, len(c.Endpoints)+len(c.EndpointConfigs))
+
+	for _, endpoint := range c.Endpoints {
+		res = append(res, c.endpoint(EndpointConfig{URL: endpoint}))
+	}
+
+	for _, e := range c.EndpointConfigs {
+		res = append(res, c.endpoint(e))
+	}
+
+	return res
 }
 
 // There is no default value for Endpoints. Set the Endpoints
@@ -56,18 +325,35 @@ func DefaultConfig() *Config {
 		RequestTimeout:    defaultRequestTimeout,
 		HeartbeatInterval: defaultHeartbeatInterval,
 		HeartbeatTimeout:  defaultHeartbeatTimeout,
+		Selector:          NewFastestFirstSelector(),
 	}
 }
 
 func (c *Config) validate() error {
-	if len(c.Endpoints) == 0 {
+	if len(c.Endpoints) == 0 && len(c.EndpointConfigs) == 0 {
 		return errInvalidEndpoint
 	}
 
-	for _, endpoint := range c.Endpoints {
-		if err := isValidEndpoint(endpoint); err != nil {
+	var (
+		seen  = make(map[string]bool)
+		names = make(map[string]bool)
+	)
+
+	for _, e := range c.endpoints() {
+		if err := e.validate(); err != nil {
 			return err
 		}
+
+		if seen[e.URL] {
+			return fmt.Errorf("%s: %w", e.name(), errDuplicateEndpoint)
+		}
+		seen[e.URL] = true
+
+		// The names key Usage and Benchmark, and identify the nodes.
+		if names[e.name()] {
+			return fmt.Errorf("%s: %w", e.name(), errDuplicateName)
+		}
+		names[e.name()] = true
 	}
 
 	if c.RequestTimeout == 0 {
@@ -82,13 +368,47 @@ func (c *Config) validate() error {
 		return errInvalidTimeout
 	}
 
+	if c.TraceTimeout < 0 || c.HeadTimeout < 0 {
+		return errInvalidTimeout
+	}
+
+	if c.Quorum != nil {
+		if err := c.Quorum.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Multicall != nil {
+		if err := c.Multicall.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Cache != nil {
+		if err := c.Cache.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.DiskCache != nil {
+		if err := c.DiskCache.validate(); err != nil {
+			return err
+		}
+	}
+
+	for endpoint, limit := range c.RateLimits {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("%s: %w", redactURL(endpoint), err)
+		}
+	}
+
 	return nil
 }
 
 func isValidEndpoint(endpoint string) error {
 	url, err := url.ParseRequestURI(endpoint)
 	if err != nil {
-		return fmt.Errorf("%s: %w", endpoint, errInvalidEndpoint)
+		return fmt.Errorf("%s: %w", redactURL(endpoint), errInvalidEndpoint)
 	}
 
 	// Websocket have not yet been considered, so disconnects are not properly
@@ -101,3 +421,22 @@ func isValidEndpoint(endpoint string) error {
 
 	return nil
 }
+
+// redactURL returns the URL without the parts that may contain secrets;
+// the user information, the path and the query. They are replaced by a
+// short hash of the URL, so that the endpoints of a provider that only
+// differ by their key have distinct names.
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "<redacted>"
+	}
+
+	res := u.Scheme + "://" + u.Host
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		sum := sha256.Sum256([]byte(endpoint))
+		res += "/<redacted:" + hex.EncodeToString(sum[:4]) + ">"
+	}
+
+	return res
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// Maximum number of blocks of an eth_feeHistory request; that of geth.
+// Smaller limits of the providers are set by EndpointConfig.BatchSize.
+const maxFeeHistoryBlocks = 1024
+
+// feeBlock is the fee history of a block. The fields are exported for
+// the digest of the quorum.
+type feeBlock struct {
+	BaseFee      *big.Int
+	NextBaseFee  *big.Int
+	GasUsedRatio float64
+	Reward       []*big.Int
+}
+
+// FeeHistoryRange requests the fee history of the blocks in a range, as
+// a single eth_feeHistory response would; BaseFee also has the base fee
+// of the block after the range. Requests of more blocks than the
+// Threshold are split over the live nodes, and into the largest requests
+// the nodes accept.
+func (r *Redgla) FeeHistoryRange(start uint64, end uint64, percentiles []float64) (*ethereum.FeeHistory, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		blocks  = make(map[uint64]*feeBlock, len(numbers))
+	)
+
+	if len(numbers) == 0 {
+		return &ethereum.FeeHistory{OldestBlock: new(big.Int).SetUint64(start)}, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		size := maxFeeHistoryBlocks
+		if client.batchSize != 0 && client.batchSize < size {
+			size = client.batchSize
+		}
+
+		res := make(map[uint64]*feeBlock, hi-lo)
+		parts := splitPart([2]int{lo, hi}, size)
+
+		err := forEach(context.Background(), 0, len(parts), timeout, quit, func(ctx context.Context, i int) error {
+			return feeHistory(ctx, client, numbers[parts[i][0]], numbers[parts[i][1]-1], percentiles, res)
+		})
+		return res, err
+	}
+
+	err = r.collect("eth_feeHistory", len(numbers), true, fn, func(m *msg) {
+		for k, v := range m.feeResponse() {
+			blocks[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ethereum.FeeHistory{
+		OldestBlock:  new(big.Int).SetUint64(start),
+		BaseFee:      make([]*big.Int, 0, len(numbers)+1),
+		GasUsedRatio: make([]float64, 0, len(numbers)),
+	}
+
+	for _, n := range numbers {
+		block := blocks[n]
+
+		res.BaseFee = append(res.BaseFee, block.BaseFee)
+		res.GasUsedRatio = append(res.GasUsedRatio, block.GasUsedRatio)
+		if len(percentiles) != 0 {
+			res.Reward = append(res.Reward, block.Reward)
+		}
+	}
+	res.BaseFee = append(res.BaseFee, blocks[end].NextBaseFee)
+
+	return res, nil
+}
+
+// feeHistory requests the fee history of the blocks [from, to] into res,
+// keyed by the block number.
+func feeHistory(ctx context.Context, client *conn, from uint64, to uint64, percentiles []float64, res map[uint64]*feeBlock) error {
+	count := to - from + 1
+
+	history, err := client.FeeHistory(ctx, count, new(big.Int).SetUint64(to), percentiles)
+	if err != nil {
+		return err
+	}
+
+	// The nodes return fewer blocks than requested, rather than failing,
+	// if they don't have all of them.
+	if history.OldestBlock == nil || history.OldestBlock.Cmp(new(big.Int).SetUint64(from)) != 0 ||
+		uint64(len(history.GasUsedRatio)) != count || uint64(len(history.BaseFee)) != count+1 ||
+		(len(percentiles) != 0 && uint64(len(history.Reward)) != count) {
+		return fmt.Errorf("fee history of blocks %d-%d is incomplete", from, to)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		block := &feeBlock{
+			BaseFee:      history.BaseFee[i],
+			NextBaseFee:  history.BaseFee[i+1],
+			GasUsedRatio: history.GasUsedRatio[i],
+		}
+		if len(percentiles) != 0 {
+			block.Reward = history.Reward[i]
+		}
+		res[from+i] = block
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type testFeeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory returns the base fee of 1000 times the block number, the
+// ratio of a ten thousandth of it, and the rewards of the number plus
+// the percentile. It refuses more than 4 blocks.
+func (testBackend) FeeHistory(count hexutil.Uint64, last rpc.BlockNumber, percentiles []float64) (*testFeeHistory, error) {
+	if count > 4 {
+		return nil, errors.New("too many blocks")
+	}
+
+	var (
+		end   = testNumber(last)
+		start = end - uint64(count) + 1
+		res   = &testFeeHistory{OldestBlock: (*hexutil.Big)(new(big.Int).SetUint64(start))}
+	)
+
+	for n := start; n <= end+1; n++ {
+		res.BaseFee = append(res.BaseFee, (*hexutil.Big)(new(big.Int).SetUint64(n*1000)))
+		if n == end+1 {
+			break
+		}
+
+		res.GasUsedRatio = append(res.GasUsedRatio, float64(n)/10000)
+		if len(percentiles) != 0 {
+			reward := make([]*hexutil.Big, len(percentiles))
+			for i, p := range percentiles {
+				reward[i] = (*hexutil.Big)(new(big.Int).SetUint64(n + uint64(p)))
+			}
+			res.Reward = append(res.Reward, reward)
+		}
+	}
+
+	return res, nil
+}
+
+func TestFeeHistoryRange(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, nil), BatchSize: 4},
+		{URL: newTestNode(t, testBackend{}, nil), BatchSize: 4},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.FeeHistoryRange(10, 29, []float64{10, 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.OldestBlock.Uint64() != 10 {
+		t.Fatalf("TestFeeHistoryRange: want %v got %v", 10, res.OldestBlock)
+	}
+	if len(res.BaseFee) != 21 || len(res.GasUsedRatio) != 20 || len(res.Reward) != 20 {
+		t.Fatalf("TestFeeHistoryRange: want %v got %v", []int{21, 20, 20}, []int{len(res.BaseFee), len(res.GasUsedRatio), len(res.Reward)})
+	}
+
+	for i, fee := range res.BaseFee {
+		if want := uint64(10+i) * 1000; fee.Uint64() != want {
+			t.Fatalf("TestFeeHistoryRange: want %v got %v", want, fee)
+		}
+	}
+	for i, reward := range res.Reward {
+		n := uint64(10 + i)
+		if res.GasUsedRatio[i] != float64(n)/10000 || reward[0].Uint64() != n+10 || reward[1].Uint64() != n+90 {
+			t.Fatalf("TestFeeHistoryRange: want %v got %v %v", n, res.GasUsedRatio[i], reward)
+		}
+	}
+
+	// Without the rewards.
+	res, err = r.FeeHistoryRange(10, 12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BaseFee) != 4 || res.Reward != nil {
+		t.Fatalf("TestFeeHistoryRange: want %v got %v", 4, len(res.BaseFee))
+	}
+}
+
+func TestFeeHistoryRangeSingleNode(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 100
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, nil), BatchSize: 4},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Below the Threshold the range isn't split over the nodes, but still
+	// into requests of the BatchSize.
+	res, err := r.FeeHistoryRange(10, 29, nil)
+	if err != nil {
+		t.Fatalf("TestFeeHistoryRangeSingleNode: want %v got %v", nil, err)
+	}
+	if len(res.BaseFee) != 21 {
+		t.Fatalf("TestFeeHistoryRangeSingleNode: want %v got %v", 21, len(res.BaseFee))
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"sync"
+)
+
+var errFlightPanic = errors.New("request panicked")
+
+// call is the request of a single item in flight.
+type call struct {
+	done chan struct{}
+	v    interface{}
+	err  error
+}
+
+// flights deduplicates the requests of the same items made at the same
+// time, so that each item is requested once no matter how many callers
+// ask for it. Only the readers of items keyed by a block number or a
+// hash go through it, see the kinds of cacheKey.
+type flights struct {
+	mu sync.Mutex
+	m  map[cacheKey]*call
+}
+
+func newFlights() *flights {
+	return &flights{m: make(map[cacheKey]*call)}
+}
+
+// do requests the items of the keys. The items that are not in flight
+// are requested by fetch, given their indices in keys, and the others
+// are waited for. If a request fails, all callers sharing it fail; if
+// fetch panics, the callers waiting for it fail with errFlightPanic.
+func (f *flights) do(keys []cacheKey, fetch func(own []int) (map[cacheKey]interface{}, error)) (map[cacheKey]interface{}, error) {
+	var (
+		calls = make([]*call, len(keys))
+		own   = make([]int, 0, len(keys))
+		mine  = make(map[*call]bool)
+	)
+
+	f.mu.Lock()
+	for i, key := range keys {
+		if c, ok := f.m[key]; ok {
+			calls[i] = c
+			continue
+		}
+
+		c := &call{done: make(chan struct{})}
+		f.m[key] = c
+		calls[i] = c
+		own = append(own, i)
+		mine[c] = true
+	}
+	f.mu.Unlock()
+
+	var (
+		res = make(map[cacheKey]interface{}, len(keys))
+		err error
+	)
+
+	// Our own items are finished before waiting for the others, which
+	// may be waiting for ours.
+	if len(own) != 0 {
+		func() {
+			var fetched map[cacheKey]interface{}
+
+			// The error stays if fetch panics.
+			err = errFlightPanic
+			defer func() {
+				f.mu.Lock()
+				for _, i := range own {
+					c := calls[i]
+					c.v, c.err = fetched[keys[i]], err
+					delete(f.m, keys[i])
+					close(c.done)
+				}
+				f.mu.Unlock()
+			}()
+
+			fetched, err = fetch(own)
+		}()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range calls {
+		if !mine[c] {
+			<-c.done
+		}
+		if c.err != nil {
+			return nil, c.err
+		}
+		if c.v != nil {
+			res[keys[i]] = c.v
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func testKeys(numbers ...uint64) []cacheKey {
+	keys := make([]cacheKey, len(numbers))
+	for i, n := range numbers {
+		keys[i] = cacheKey{kind: kindBlock, number: n}
+	}
+	return keys
+}
+
+func TestFlights(t *testing.T) {
+	var (
+		f       = newFlights()
+		release = make(chan struct{})
+		errc    = make(chan error, 1)
+	)
+
+	fetch := func(keys []cacheKey, fetched *[]uint64) func(own []int) (map[cacheKey]interface{}, error) {
+		return func(own []int) (map[cacheKey]interface{}, error) {
+			res := make(map[cacheKey]interface{})
+			for _, i := range own {
+				*fetched = append(*fetched, keys[i].number)
+				res[keys[i]] = keys[i].number
+			}
+			return res, nil
+		}
+	}
+
+	var first []uint64
+	go func() {
+		keys := testKeys(1, 2, 3)
+		_, err := f.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+			<-release
+			return fetch(keys, &first)(own)
+		})
+		errc <- err
+	}()
+
+	for i := 0; ; i++ {
+		f.mu.Lock()
+		n := len(f.m)
+		f.mu.Unlock()
+
+		if n == 3 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("TestFlights: the first call is not in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	var (
+		second []uint64
+		keys   = testKeys(2, 3, 4)
+	)
+
+	res, err := f.do(keys, fetch(keys, &second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the item that is not in flight is requested again.
+	if len(second) != 1 || second[0] != 4 {
+		t.Fatalf("TestFlights: want %v got %v", []uint64{4}, second)
+	}
+	for _, key := range keys {
+		if res[key] != key.number {
+			t.Fatalf("TestFlights: want %v got %v", key.number, res[key])
+		}
+	}
+
+	if len(f.m) != 0 {
+		t.Fatalf("TestFlights: want %v got %v", 0, len(f.m))
+	}
+}
+
+func TestFlightsFailure(t *testing.T) {
+	var (
+		f    = newFlights()
+		fail = errors.New("failure")
+	)
+
+	_, err := f.do(testKeys(1), func(own []int) (map[cacheKey]interface{}, error) {
+		return nil, fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("TestFlightsFailure: want %v got %v", fail, err)
+	}
+
+	// The failure isn't kept.
+	res, err := f.do(testKeys(1), func(own []int) (map[cacheKey]interface{}, error) {
+		return map[cacheKey]interface{}{testKeys(1)[0]: 1}, nil
+	})
+	if err != nil || len(res) != 1 {
+		t.Fatalf("TestFlightsFailure: want %v got %v (%v)", 1, len(res), err)
+	}
+}
+
+func TestFlightsPanic(t *testing.T) {
+	var (
+		f       = newFlights()
+		keys    = testKeys(1, 2)
+		started = make(chan struct{})
+		release = make(chan struct{})
+		done    = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		defer func() { recover() }()
+
+		f.do(keys[:1], func(own []int) (map[cacheKey]interface{}, error) {
+			close(started)
+			<-release
+			panic("fetch")
+		})
+	}()
+	<-started
+
+	// The second caller waits for the first key, which panics.
+	_, err := f.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		close(release)
+		return map[cacheKey]interface{}{keys[1]: 1}, nil
+	})
+	if !errors.Is(err, errFlightPanic) {
+		t.Fatalf("TestFlightsPanic: want %v got %v", errFlightPanic, err)
+	}
+
+	<-done
+	if len(f.m) != 0 {
+		t.Fatalf("TestFlightsPanic: want %v got %v", 0, len(f.m))
+	}
+}
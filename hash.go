@@ -0,0 +1,206 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Maximum number of hashes kept by chainHashes. The oldest are dropped
+// first.
+const maxChainHashes = 1 << 17
+
+// headerExtension is the fields of the headers added by the forks after
+// those types.Header knows, from Cancun. The header drops them, so its
+// Hash isn't the hash of the block on the chain.
+type headerExtension struct {
+	BlobGasUsed      *hexutil.Uint64 `json:"blobGasUsed"`
+	ExcessBlobGas    *hexutil.Uint64 `json:"excessBlobGas"`
+	ParentBeaconRoot *common.Hash    `json:"parentBeaconBlockRoot"`
+	RequestsHash     *common.Hash    `json:"requestsHash"`
+}
+
+func (e *headerExtension) empty() bool {
+	return e.BlobGasUsed == nil && e.ExcessBlobGas == nil && e.ParentBeaconRoot == nil && e.RequestsHash == nil
+}
+
+// extendedHeader is the consensus encoding of a header with its
+// extension.
+type extendedHeader struct {
+	ParentHash       common.Hash
+	UncleHash        common.Hash
+	Coinbase         common.Address
+	Root             common.Hash
+	TxHash           common.Hash
+	ReceiptHash      common.Hash
+	Bloom            types.Bloom
+	Difficulty       *big.Int
+	Number           *big.Int
+	GasLimit         uint64
+	GasUsed          uint64
+	Time             uint64
+	Extra            []byte
+	MixDigest        common.Hash
+	Nonce            types.BlockNonce
+	BaseFee          *big.Int     `rlp:"optional"`
+	WithdrawalsHash  *common.Hash `rlp:"optional"`
+	BlobGasUsed      *uint64      `rlp:"optional"`
+	ExcessBlobGas    *uint64      `rlp:"optional"`
+	ParentBeaconRoot *common.Hash `rlp:"optional"`
+	RequestsHash     *common.Hash `rlp:"optional"`
+}
+
+// hash returns the hash of the header with the extension.
+func (e *headerExtension) hash(h *types.Header) common.Hash {
+	if e.empty() {
+		return h.Hash()
+	}
+
+	enc := &extendedHeader{
+		ParentHash:       h.ParentHash,
+		UncleHash:        h.UncleHash,
+		Coinbase:         h.Coinbase,
+		Root:             h.Root,
+		TxHash:           h.TxHash,
+		ReceiptHash:      h.ReceiptHash,
+		Bloom:            h.Bloom,
+		Difficulty:       h.Difficulty,
+		Number:           h.Number,
+		GasLimit:         h.GasLimit,
+		GasUsed:          h.GasUsed,
+		Time:             h.Time,
+		Extra:            h.Extra,
+		MixDigest:        h.MixDigest,
+		Nonce:            h.Nonce,
+		BaseFee:          h.BaseFee,
+		WithdrawalsHash:  h.WithdrawalsHash,
+		ParentBeaconRoot: e.ParentBeaconRoot,
+		RequestsHash:     e.RequestsHash,
+	}
+	if e.BlobGasUsed != nil {
+		v := uint64(*e.BlobGasUsed)
+		enc.BlobGasUsed = &v
+	}
+	if e.ExcessBlobGas != nil {
+		v := uint64(*e.ExcessBlobGas)
+		enc.ExcessBlobGas = &v
+	}
+
+	// The encoding of the header can't fail.
+	b, _ := rlp.EncodeToBytes(enc)
+	return crypto.Keccak256Hash(b)
+}
+
+// hashTable maps the hashes of the headers with an extension, as
+// types.Header computes them, to their hashes on the chain.
+type hashTable struct {
+	mu sync.Mutex
+	m  map[common.Hash]common.Hash
+
+	// Keys in the order they were set, as a ring.
+	keys []common.Hash
+	next int
+}
+
+var chainHashes = newHashTable(maxChainHashes)
+
+func newHashTable(size int) *hashTable {
+	return &hashTable{
+		m:    make(map[common.Hash]common.Hash),
+		keys: make([]common.Hash, 0, size),
+	}
+}
+
+func (t *hashTable) set(local common.Hash, chain common.Hash) {
+	if local == chain {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.m[local]; ok {
+		t.m[local] = chain
+		return
+	}
+
+	if len(t.keys) < cap(t.keys) {
+		t.keys = append(t.keys, local)
+	} else {
+		delete(t.m, t.keys[t.next])
+		t.keys[t.next] = local
+		t.next = (t.next + 1) % len(t.keys)
+	}
+	t.m[local] = chain
+}
+
+func (t *hashTable) get(local common.Hash) common.Hash {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if chain, ok := t.m[local]; ok {
+		return chain
+	}
+	return local
+}
+
+// chainHash returns the hash of the block on the chain, which Hash isn't
+// for the blocks with a header extension.
+func chainHash(block *types.Block) common.Hash {
+	return chainHashes.get(block.Hash())
+}
+
+// headerHash is chainHash of a header.
+func headerHash(header *types.Header) common.Hash {
+	return chainHashes.get(header.Hash())
+}
+
+// decodeHeader decodes the header of a block, or a header, in JSON and
+// records its hash on the chain.
+func decodeHeader(raw json.RawMessage) (*types.Header, common.Hash, error) {
+	var (
+		header    *types.Header
+		extension headerExtension
+	)
+
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if err := json.Unmarshal(raw, &extension); err != nil {
+		return nil, common.Hash{}, err
+	}
+
+	hash := extension.hash(header)
+	chainHashes.set(header.Hash(), hash)
+
+	return header, hash, nil
+}
+
+// getHeader requests the header like ethclient.Client.HeaderByNumber and
+// HeaderByHash, given the method and its first argument.
+func getHeader(ctx context.Context, c *rpc.Client, method string, arg interface{}) (*types.Header, error) {
+	var raw json.RawMessage
+	if err := c.CallContext(ctx, &raw, method, arg, false); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+
+	header, _, err := decodeHeader(raw)
+	return header, err
+}
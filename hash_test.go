@@ -0,0 +1,119 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testCancunBackend serves the headers with the fields added from
+// Cancun, which types.Header doesn't know. The parent hashes and the
+// hashes reported are those of the whole headers.
+type testCancunBackend struct {
+	testBackend
+}
+
+func (b testCancunBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	n := testNumber(number)
+	header, extension := testCancunHeader(n)
+
+	res, err := marshalBlock(header)
+	if err != nil {
+		return nil, err
+	}
+	res["blobGasUsed"] = extension.BlobGasUsed
+	res["excessBlobGas"] = extension.ExcessBlobGas
+	res["parentBeaconBlockRoot"] = extension.ParentBeaconRoot
+	res["hash"] = testCancunHash(n)
+
+	return res, nil
+}
+
+func testCancunHeader(number uint64) (*types.Header, *headerExtension) {
+	header := testHeader(number)
+	header.BaseFee = big.NewInt(7)
+	header.WithdrawalsHash = &types.EmptyRootHash
+	if number != 0 {
+		header.ParentHash = testCancunHash(number - 1)
+	}
+
+	var (
+		gas  = hexutil.Uint64(0x20000)
+		root = common.Hash{byte(number)}
+	)
+
+	return header, &headerExtension{
+		BlobGasUsed:      &gas,
+		ExcessBlobGas:    &gas,
+		ParentBeaconRoot: &root,
+	}
+}
+
+var testCancunHashes sync.Map
+
+func testCancunHash(number uint64) common.Hash {
+	if hash, ok := testCancunHashes.Load(number); ok {
+		return hash.(common.Hash)
+	}
+
+	header, extension := testCancunHeader(number)
+	hash := extension.hash(header)
+	testCancunHashes.Store(number, hash)
+
+	return hash
+}
+
+func TestHeaderExtension(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Verify = true
+	cfg.CheckParentHash = true
+	cfg.Endpoints = []string{
+		newTestNode(t, testCancunBackend{}, nil),
+		newTestNode(t, testCancunBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	blocks, err := r.BlockByRange(10, 30)
+	if err != nil {
+		t.Fatalf("TestHeaderExtension: want %v got %v", nil, err)
+	}
+	if len(blocks) != 21 {
+		t.Fatalf("TestHeaderExtension: want %v got %v", 21, len(blocks))
+	}
+
+	for n, block := range blocks {
+		if block.Hash() == testCancunHash(n) {
+			t.Fatal("TestHeaderExtension: the header has no extension")
+		}
+		if chainHash(block) != testCancunHash(n) {
+			t.Fatalf("TestHeaderExtension: want %v got %v", testCancunHash(n), chainHash(block))
+		}
+	}
+}
+
+func TestHashTable(t *testing.T) {
+	table := newHashTable(2)
+
+	table.set(common.Hash{1}, common.Hash{11})
+	table.set(common.Hash{2}, common.Hash{12})
+	table.set(common.Hash{3}, common.Hash{13})
+
+	if got := table.get(common.Hash{1}); got != (common.Hash{1}) {
+		t.Fatalf("TestHashTable: want %v got %v", common.Hash{1}, got)
+	}
+	if got := table.get(common.Hash{3}); got != (common.Hash{13}) {
+		t.Fatalf("TestHashTable: want %v got %v", common.Hash{13}, got)
+	}
+}
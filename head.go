@@ -0,0 +1,337 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	defaultHeadTimeout = time.Minute
+
+	// Number of heights below the head whose hashes are remembered to
+	// detect the reorgs. Deeper reorgs are not reported.
+	maxHeadReorgDepth = 64
+)
+
+var errHeadStalled = errors.New("no new head")
+
+// NewHead is a head of the chain sent by SubscribeNewHead.
+type NewHead struct {
+	Header *types.Header
+
+	// Hash of the block previously sent at the height of the header, if
+	// the header replaces it because of a reorg.
+	Replaced *common.Hash
+
+	// Name of the node the head comes from.
+	Node string
+
+	// Failure of the node the heads came from before, or of finding a
+	// live node, set on the first head sent after it.
+	Err error
+}
+
+// SubscribeNewHead sends the new heads of the chain to ch. The heads
+// come from a live node with EndpointConfig.WebSocket, subscribing to
+// them, or else from a live node polled every HeartbeatInterval. If the
+// node fails or sends no new head for Config.HeadTimeout, the heads come
+// from another node from then on.
+//
+// Heads are sent once. If the hash at a sent height changes, the new
+// header is sent with Replaced set, along with the replaced ancestors
+// of the new head. The subscription fails only if ctx is done; the
+// failures of the nodes are reported in NewHead.Err.
+func (r *Redgla) SubscribeNewHead(ctx context.Context, ch chan<- *NewHead) (ethereum.Subscription, error) {
+	// The heads are polled with eth_getBlockByNumber.
+	if _, err := r.pick("eth_getBlockByNumber", 1); err != nil {
+		return nil, err
+	}
+
+	heads := &heads{ch: ch, seen: make(map[uint64]common.Hash)}
+
+	return event.NewSubscription(func(unsub <-chan struct{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-unsub:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		var failed string
+		for {
+			start := time.Now()
+
+			node, err := r.headNode(failed)
+			if err == nil {
+				err = r.followHeads(ctx, node, heads)
+				failed = node.URL
+			}
+			heads.fail(err)
+
+			if ctx.Err() != nil {
+				select {
+				case <-unsub:
+					return nil
+				default:
+					return ctx.Err()
+				}
+			}
+
+			// Without a live node, or a node that fails right away,
+			// wait for the next heartbeat.
+			if err != nil || time.Since(start) < r.cfg.HeartbeatInterval {
+				select {
+				case <-time.After(r.cfg.HeartbeatInterval):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}), nil
+}
+
+// headNode returns the live node to follow the heads of, preferring the
+// nodes with a WebSocket URL. The node that failed last is avoided, if
+// there are others.
+func (r *Redgla) headNode(failed string) (EndpointConfig, error) {
+	nodes, err := r.pick("eth_getBlockByNumber", math.MaxInt)
+	if err != nil {
+		return EndpointConfig{}, err
+	}
+
+	var res EndpointConfig
+	for _, node := range nodes {
+		if node.URL == failed && len(nodes) > 1 {
+			continue
+		}
+		if node.WebSocket != "" {
+			return node, nil
+		}
+		if res.URL == "" {
+			res = node
+		}
+	}
+
+	return res, nil
+}
+
+func (r *Redgla) headTimeout() time.Duration {
+	if r.cfg.HeadTimeout == 0 {
+		return defaultHeadTimeout
+	}
+	return r.cfg.HeadTimeout
+}
+
+// followHeads sends the heads of the node until it fails, stalls or ctx
+// is done.
+func (r *Redgla) followHeads(ctx context.Context, node EndpointConfig, heads *heads) error {
+	if node.WebSocket != "" {
+		return redactError(r.subscribeHeads(ctx, node, heads), node)
+	}
+	return redactError(r.pollHeads(ctx, node, heads), node)
+}
+
+func (r *Redgla) subscribeHeads(ctx context.Context, node EndpointConfig, heads *heads) error {
+	c, err := rpc.DialOptions(ctx, node.WebSocket, node.dialOptions()...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// The heads are decoded here; types.Header drops the fields that make
+	// their hash, see headerHash.
+	headc := make(chan json.RawMessage, 16)
+
+	sub, err := c.EthSubscribe(ctx, headc, "newHeads")
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	timer := time.NewTimer(r.headTimeout())
+	defer timer.Stop()
+
+	for {
+		select {
+		case raw := <-headc:
+			header, _, err := decodeHeader(raw)
+			if err != nil {
+				return err
+			}
+			if err := heads.add(ctx, c, node, header, 0); err != nil {
+				return err
+			}
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(r.headTimeout())
+
+		case err := <-sub.Err():
+			return err
+
+		case <-timer.C:
+			return errHeadStalled
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Redgla) pollHeads(ctx context.Context, node EndpointConfig, heads *heads) error {
+	c, err := r.dial(node)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ticker := time.NewTicker(r.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		if err := r.pollHead(ctx, c.rpc, node, heads, &last); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pollHead sends the heads above the last one sent, if the block number
+// of the node has increased since. last is the time it last increased.
+func (r *Redgla) pollHead(ctx context.Context, client *rpc.Client, node EndpointConfig, heads *heads, last *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.headTimeout())
+	defer cancel()
+
+	latest, err := getHeader(ctx, client, "eth_getBlockByNumber", "latest")
+	if err != nil {
+		return err
+	}
+	number := latest.Number.Uint64()
+
+	if heads.known && number <= heads.head {
+		// The head may be replaced at the same height.
+		if number == heads.head {
+			if err := heads.add(ctx, client, node, latest, 0); err != nil {
+				return err
+			}
+		}
+		if time.Since(*last) > r.headTimeout() {
+			return errHeadStalled
+		}
+		return nil
+	}
+	*last = time.Now()
+
+	// Only the latest head is sent after a long gap.
+	from := number
+	if heads.known && number-heads.head <= maxHeadReorgDepth {
+		from = heads.head + 1
+	}
+
+	for n := from; n < number; n++ {
+		header, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.EncodeUint64(n))
+		if err != nil {
+			return err
+		}
+		if err := heads.add(ctx, client, node, header, 0); err != nil {
+			return err
+		}
+	}
+
+	return heads.add(ctx, client, node, latest, 0)
+}
+
+// heads is the state of a subscription of SubscribeNewHead.
+type heads struct {
+	ch chan<- *NewHead
+
+	// Hashes of the heights sent, down to maxHeadReorgDepth below the
+	// highest one.
+	seen  map[uint64]common.Hash
+	head  uint64
+	known bool
+
+	// Failure of the last node, sent with the next head.
+	err error
+}
+
+// fail records why the node followed failed, or why there was none.
+func (h *heads) fail(err error) {
+	if err != nil {
+		h.err = err
+	}
+}
+
+// add sends the header, after the ancestors it replaces. depth is the
+// number of descendants of the header being added.
+func (h *heads) add(ctx context.Context, client *rpc.Client, node EndpointConfig, header *types.Header, depth int) error {
+	var (
+		n    = header.Number.Uint64()
+		hash = headerHash(header)
+	)
+
+	// Already sent, or too old to tell if it was.
+	if h.seen[n] == hash || (h.known && n+maxHeadReorgDepth < h.head) {
+		return nil
+	}
+
+	// The parent replaces the block sent at its height.
+	if parent, ok := h.seen[n-1]; n > 0 && ok && parent != header.ParentHash && depth < maxHeadReorgDepth {
+		ancestor, err := getHeader(ctx, client, "eth_getBlockByHash", header.ParentHash)
+		if err != nil {
+			return err
+		}
+		if err := h.add(ctx, client, node, ancestor, depth+1); err != nil {
+			return err
+		}
+	}
+
+	head := &NewHead{Header: header, Node: node.name(), Err: h.err}
+	if old, ok := h.seen[n]; ok {
+		head.Replaced = &old
+	}
+
+	h.seen[n] = hash
+	if !h.known || n > h.head {
+		h.head, h.known = n, true
+	}
+
+	for k := range h.seen {
+		if k+maxHeadReorgDepth < h.head {
+			delete(h.seen, k)
+		}
+	}
+
+	select {
+	case h.ch <- head:
+		h.err = nil
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
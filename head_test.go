@@ -0,0 +1,263 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testHeadBackend serves the chain of testBackend up to head, forked
+// from the block fork if it isn't zero.
+type testHeadBackend struct {
+	head *uint64
+	fork *uint64
+}
+
+func newTestHeadBackend(head uint64) testHeadBackend {
+	return testHeadBackend{head: &head, fork: new(uint64)}
+}
+
+func (b testHeadBackend) header(number uint64) *types.Header {
+	if fork := atomic.LoadUint64(b.fork); fork != 0 {
+		return testForkHeader(number, fork)
+	}
+	return testHeader(number)
+}
+
+func (b testHeadBackend) ChainId() *hexutil.Big {
+	return testBackend{}.ChainId()
+}
+
+func (b testHeadBackend) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(atomic.LoadUint64(b.head))
+}
+
+func (b testHeadBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	if number < 0 {
+		return marshalBlock(b.header(atomic.LoadUint64(b.head)))
+	}
+	return marshalBlock(b.header(uint64(number)))
+}
+
+func (b testHeadBackend) GetBlockByHash(hash common.Hash, full bool) (map[string]interface{}, error) {
+	for n := atomic.LoadUint64(b.head); n > 0; n-- {
+		if header := b.header(n); header.Hash() == hash {
+			return marshalBlock(header)
+		}
+	}
+	return nil, nil
+}
+
+// NewHeads sends a new head every 20ms, from the head of the backend.
+func (b testHeadBackend) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+
+	sub := notifier.CreateSubscription()
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				notifier.Notify(sub.ID, b.header(atomic.AddUint64(b.head, 1)))
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+func testNextHead(t *testing.T, ch chan *NewHead) *NewHead {
+	select {
+	case head := <-ch:
+		return head
+	case <-time.After(5 * time.Second):
+		t.Fatal("no new head")
+		return nil
+	}
+}
+
+func TestSubscribeNewHeadPolling(t *testing.T) {
+	backend := newTestHeadBackend(100)
+
+	cfg := DefaultConfig()
+	cfg.HeartbeatInterval = 20 * time.Millisecond
+	cfg.Endpoints = []string{newTestNode(t, backend, nil)}
+
+	r := newTestRedgla(t, cfg)
+
+	ch := make(chan *NewHead)
+
+	sub, err := r.SubscribeNewHead(context.Background(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	if head := testNextHead(t, ch); head.Header.Number.Uint64() != 100 {
+		t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", 100, head.Header.Number)
+	}
+
+	atomic.StoreUint64(backend.head, 102)
+	for n := uint64(101); n <= 102; n++ {
+		if head := testNextHead(t, ch); head.Header.Number.Uint64() != n || head.Replaced != nil {
+			t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", n, head.Header.Number)
+		}
+	}
+
+	// The blocks from 101 are replaced.
+	atomic.StoreUint64(backend.fork, 101)
+	atomic.StoreUint64(backend.head, 103)
+
+	for n := uint64(101); n <= 103; n++ {
+		head := testNextHead(t, ch)
+		if head.Header.Number.Uint64() != n || head.Header.Hash() != testForkHash(n, 101) {
+			t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", n, head.Header.Number)
+		}
+		if n < 103 && (head.Replaced == nil || *head.Replaced != testHash(n)) {
+			t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", testHash(n), head.Replaced)
+		}
+	}
+
+	// The head is replaced at the same height, with its ancestors.
+	atomic.StoreUint64(backend.fork, 102)
+
+	for n := uint64(101); n <= 103; n++ {
+		head := testNextHead(t, ch)
+		if head.Header.Number.Uint64() != n || head.Header.Hash() != testForkHash(n, 102) {
+			t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", n, head.Header.Number)
+		}
+		if head.Replaced == nil || *head.Replaced != testForkHash(n, 101) {
+			t.Fatalf("TestSubscribeNewHeadPolling: want %v got %v", testForkHash(n, 101), head.Replaced)
+		}
+	}
+}
+
+// testOrderSelector selects the candidates in the order of the endpoints.
+type testOrderSelector []string
+
+func (s testOrderSelector) Select(candidates []Candidate, n int) []Candidate {
+	var res []Candidate
+	for _, endpoint := range s {
+		for _, c := range candidates {
+			if c.Endpoint == endpoint {
+				res = append(res, c)
+			}
+		}
+	}
+	return head(res, n)
+}
+
+func TestSubscribeNewHeadFailover(t *testing.T) {
+	var (
+		stalled = newTestHeadBackend(100)
+		live    = newTestHeadBackend(100)
+	)
+
+	cfg := DefaultConfig()
+	cfg.HeartbeatInterval = 20 * time.Millisecond
+	cfg.HeadTimeout = 200 * time.Millisecond
+	cfg.Endpoints = []string{
+		newTestNode(t, stalled, nil),
+		newTestNode(t, live, nil),
+	}
+	cfg.Selector = testOrderSelector(cfg.Endpoints)
+
+	r := newTestRedgla(t, cfg)
+
+	ch := make(chan *NewHead)
+
+	sub, err := r.SubscribeNewHead(context.Background(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	if head := testNextHead(t, ch); head.Header.Number.Uint64() != 100 || head.Node != redactURL(cfg.Endpoints[0]) {
+		t.Fatalf("TestSubscribeNewHeadFailover: want %v got %v", cfg.Endpoints[0], head.Node)
+	}
+
+	// The first node stalls, the head comes from the second one.
+	atomic.StoreUint64(live.head, 101)
+
+	head := testNextHead(t, ch)
+	if head.Header.Number.Uint64() != 101 || head.Node != redactURL(cfg.Endpoints[1]) {
+		t.Fatalf("TestSubscribeNewHeadFailover: want %v got %v", cfg.Endpoints[1], head.Node)
+	}
+
+	// Along with the failure of the first node.
+	if !errors.Is(head.Err, errHeadStalled) {
+		t.Fatalf("TestSubscribeNewHeadFailover: want %v got %v", errHeadStalled, head.Err)
+	}
+}
+
+func TestSubscribeNewHeadWebSocket(t *testing.T) {
+	backend := newTestHeadBackend(100)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", backend); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	t.Cleanup(func() {
+		ws.Close()
+		server.Stop()
+	})
+
+	cfg := DefaultConfig()
+	cfg.EndpointConfigs = []EndpointConfig{{
+		URL:       newTestNode(t, backend, nil),
+		Name:      "ws",
+		WebSocket: "ws" + strings.TrimPrefix(ws.URL, "http"),
+	}}
+
+	r := newTestRedgla(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *NewHead)
+
+	sub, err := r.SubscribeNewHead(ctx, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := testNextHead(t, ch)
+	for i := uint64(1); i <= 3; i++ {
+		head := testNextHead(t, ch)
+		if want := first.Header.Number.Uint64() + i; head.Header.Number.Uint64() != want || head.Node != "ws" {
+			t.Fatalf("TestSubscribeNewHeadWebSocket: want %v got %v", want, head.Header.Number)
+		}
+	}
+
+	// The subscription fails once the context is done.
+	cancel()
+	select {
+	case err := <-sub.Err():
+		if err != context.Canceled {
+			t.Fatalf("TestSubscribeNewHeadWebSocket: want %v got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestSubscribeNewHeadWebSocket: subscription is not over")
+	}
+}
@@ -6,10 +6,13 @@
 package redgla
 
 import (
+	"encoding/json"
+	"math/big"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
 )
 
 // Internal messages.
@@ -24,10 +27,18 @@ func (m *msg) benchmarkResponse() time.Duration {
 	return m.v.(time.Duration)
 }
 
+func (m *msg) blockNumberResponse() uint64 {
+	return m.v.(uint64)
+}
+
 func (m *msg) blockResponse() map[uint64]*types.Block {
 	return m.v.(map[uint64]*types.Block)
 }
 
+func (m *msg) headerResponse() map[uint64]*types.Header {
+	return m.v.(map[uint64]*types.Header)
+}
+
 func (m *msg) transactionResponse() map[common.Hash]*types.Transaction {
 	return m.v.(map[common.Hash]*types.Transaction)
 }
@@ -35,3 +46,63 @@ func (m *msg) transactionResponse() map[common.Hash]*types.Transaction {
 func (m *msg) receiptResponse() map[common.Hash]*types.Receipt {
 	return m.v.(map[common.Hash]*types.Receipt)
 }
+
+func (m *msg) uncleResponse() map[uint64][]*types.Header {
+	return m.v.(map[uint64][]*types.Header)
+}
+
+func (m *msg) indexedTransactionResponse() map[int]*types.Transaction {
+	return m.v.(map[int]*types.Transaction)
+}
+
+func (m *msg) countResponse() map[uint64]uint {
+	return m.v.(map[uint64]uint)
+}
+
+func (m *msg) bigResponse() map[int]*big.Int {
+	return m.v.(map[int]*big.Int)
+}
+
+func (m *msg) nonceResponse() map[int]uint64 {
+	return m.v.(map[int]uint64)
+}
+
+func (m *msg) hashResponse() map[int]common.Hash {
+	return m.v.(map[int]common.Hash)
+}
+
+func (m *msg) bytesResponse() map[int][]byte {
+	return m.v.(map[int][]byte)
+}
+
+func (m *msg) proofResponse() map[int]*gethclient.AccountResult {
+	return m.v.(map[int]*gethclient.AccountResult)
+}
+
+func (m *msg) blockTraceResponse() map[uint64][]*TransactionTrace {
+	return m.v.(map[uint64][]*TransactionTrace)
+}
+
+func (m *msg) transactionTraceResponse() map[common.Hash]*CallFrame {
+	return m.v.(map[common.Hash]*CallFrame)
+}
+
+func (m *msg) filterTraceResponse() map[uint64][]*Trace {
+	return m.v.(map[uint64][]*Trace)
+}
+
+func (m *msg) feeResponse() map[uint64]*feeBlock {
+	return m.v.(map[uint64]*feeBlock)
+}
+
+func (m *msg) rawResponse() map[int]json.RawMessage {
+	return m.v.(map[int]json.RawMessage)
+}
+
+func (m *msg) rawBatchResponse() map[int]rawResult {
+	return m.v.(map[int]rawResult)
+}
+
+func (m *msg) callResponse() map[int]CallResult {
+	return m.v.(map[int]CallResult)
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Code hash of the accounts without code.
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// ProofsAt requests the accounts of the addresses along with the given
+// storage slots of each, and verifies their Merkle proofs against the
+// state root of the block. If block is nil, it is the latest block.
+// Requests of more addresses than the Threshold are split over the live
+// nodes.
+//
+// The header of the block is requested on its own, possibly from another
+// node than the proofs. It comes from a single node unless Config.Quorum
+// is set, so only a quorum keeps a node from forging the root the proofs
+// are verified against. Nodes returning an invalid proof fail with
+// ErrInvalidData, and the request is retried on the next node.
+func (r *Redgla) ProofsAt(addresses []common.Address, slots []common.Hash, block *big.Int) (map[common.Address]*gethclient.AccountResult, error) {
+	addresses = uniqueAddresses(addresses)
+
+	result := make(map[common.Address]*gethclient.AccountResult, len(addresses))
+	if len(addresses) == 0 {
+		return result, nil
+	}
+
+	// The proofs must be of the block whose header is known.
+	if block == nil {
+		head, err := r.blockNumber()
+		if err != nil {
+			return nil, err
+		}
+		block = new(big.Int).SetUint64(head)
+	}
+	if !block.IsUint64() {
+		return nil, errInvalidBlockTag
+	}
+
+	number := block.Uint64()
+
+	var root common.Hash
+
+	err := r.collect("eth_getBlockByNumber", 1, false, fetchHeader(number), func(m *msg) {
+		root = m.headerResponse()[number].Root
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = slot.Hex()
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[int]*gethclient.AccountResult, hi-lo)
+		err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) error {
+			proof, err := gethclient.New(client.rpc).GetProof(ctx, addresses[i], keys, block)
+			if err != nil {
+				return err
+			}
+			if err := verifyProof(root, addresses[i], slots, proof); err != nil {
+				return err
+			}
+			res[i] = proof
+			return nil
+		})
+		return res, err
+	}
+
+	err = r.collectTagged("eth_getProof", r.stateTag(block), len(addresses), true, fn, func(m *msg) {
+		for k, v := range m.proofResponse() {
+			result[addresses[k]] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// verifyProof checks the account and the storage slots of the proof
+// against the state root.
+func verifyProof(root common.Hash, address common.Address, slots []common.Hash, proof *gethclient.AccountResult) error {
+	if proof.Address != address {
+		return fmt.Errorf("%w: proof of %s returned for %s", ErrInvalidData, proof.Address, address)
+	}
+	if proof.Balance == nil {
+		return fmt.Errorf("%w: proof of %s has no balance", ErrInvalidData, address)
+	}
+
+	value, err := verifyTrieProof(root, address.Bytes(), proof.AccountProof)
+	if err != nil {
+		return fmt.Errorf("%w: account proof of %s: %v", ErrInvalidData, address, err)
+	}
+
+	// A missing account is the empty account.
+	account := types.StateAccount{
+		Balance:  new(big.Int),
+		Root:     types.EmptyRootHash,
+		CodeHash: emptyCodeHash.Bytes(),
+	}
+	if value != nil {
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return fmt.Errorf("%w: account of %s: %v", ErrInvalidData, address, err)
+		}
+	}
+
+	if account.Nonce != proof.Nonce || account.Balance.Cmp(proof.Balance) != 0 ||
+		account.Root != proof.StorageHash || !bytes.Equal(account.CodeHash, proof.CodeHash.Bytes()) {
+		// Some nodes return zero hashes for the missing accounts.
+		if value != nil || proof.Nonce != 0 || proof.Balance.Sign() != 0 ||
+			proof.StorageHash != (common.Hash{}) || proof.CodeHash != (common.Hash{}) {
+			return fmt.Errorf("%w: account of %s differs from its proof", ErrInvalidData, address)
+		}
+	}
+
+	if len(proof.StorageProof) != len(slots) {
+		return fmt.Errorf("%w: %d storage proofs of %s for %d slots", ErrInvalidData, len(proof.StorageProof), address, len(slots))
+	}
+
+	for i, slot := range slots {
+		storage := proof.StorageProof[i]
+
+		// Some nodes return the keys without their leading zeros.
+		if common.HexToHash(storage.Key) != slot {
+			return fmt.Errorf("%w: storage proof of %s returned for %s", ErrInvalidData, storage.Key, slot)
+		}
+		if storage.Value == nil {
+			return fmt.Errorf("%w: storage proof of %s has no value", ErrInvalidData, slot)
+		}
+
+		value, err := verifyTrieProof(account.Root, slot.Bytes(), storage.Proof)
+		if err != nil {
+			return fmt.Errorf("%w: storage proof of %s of %s: %v", ErrInvalidData, slot, address, err)
+		}
+
+		// A missing slot is zero.
+		var content []byte
+		if value != nil {
+			if _, content, _, err = rlp.Split(value); err != nil {
+				return fmt.Errorf("%w: storage %s of %s: %v", ErrInvalidData, slot, address, err)
+			}
+		}
+
+		if new(big.Int).SetBytes(content).Cmp(storage.Value) != 0 {
+			return fmt.Errorf("%w: storage %s of %s differs from its proof", ErrInvalidData, slot, address)
+		}
+	}
+
+	return nil
+}
+
+// verifyTrieProof returns the value of the key in the trie of the root,
+// or nil if the proof shows it is missing. Keys are hashed, as in the
+// secure tries of the state.
+func verifyTrieProof(root common.Hash, key []byte, proof []string) ([]byte, error) {
+	// Nothing is in an empty trie.
+	if root == types.EmptyRootHash {
+		return nil, nil
+	}
+
+	db := memorydb.New()
+	for _, node := range proof {
+		b, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Put(crypto.Keccak256(b), b); err != nil {
+			return nil, err
+		}
+	}
+
+	return trie.VerifyProof(root, crypto.Keccak256(key), db)
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testState is a state of accounts whose last byte of the address is
+// their nonce and a hundredth of their balance. Their storage slot k
+// holds k times the nonce, for k in 1 and 2.
+type testState struct {
+	mu       sync.Mutex
+	accounts *trie.Trie
+	storage  map[common.Address]*trie.Trie
+}
+
+func newTestState(addresses []common.Address) *testState {
+	s := &testState{
+		accounts: trie.NewEmpty(trie.NewDatabase(rawdb.NewMemoryDatabase())),
+		storage:  make(map[common.Address]*trie.Trie),
+	}
+
+	for _, address := range addresses {
+		nonce := uint64(address[common.AddressLength-1])
+
+		storage := trie.NewEmpty(trie.NewDatabase(rawdb.NewMemoryDatabase()))
+		for k := uint64(1); k <= 2; k++ {
+			value, _ := rlp.EncodeToBytes(new(big.Int).SetUint64(k * nonce).Bytes())
+			storage.Update(crypto.Keccak256(testSlot(k).Bytes()), value)
+		}
+		s.storage[address] = storage
+
+		account, _ := rlp.EncodeToBytes(&types.StateAccount{
+			Nonce:    nonce,
+			Balance:  new(big.Int).SetUint64(nonce * 100),
+			Root:     storage.Hash(),
+			CodeHash: emptyCodeHash.Bytes(),
+		})
+		s.accounts.Update(crypto.Keccak256(address.Bytes()), account)
+	}
+
+	return s
+}
+
+func testSlot(k uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(k))
+}
+
+// proofList collects the nodes of a proof.
+type proofList []string
+
+func (l *proofList) Put(key []byte, value []byte) error {
+	*l = append(*l, hexutil.Encode(value))
+	return nil
+}
+
+func (l *proofList) Delete(key []byte) error {
+	return nil
+}
+
+type testStorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+type testAccountResult struct {
+	Address      common.Address      `json:"address"`
+	AccountProof []string            `json:"accountProof"`
+	Balance      *hexutil.Big        `json:"balance"`
+	CodeHash     common.Hash         `json:"codeHash"`
+	Nonce        hexutil.Uint64      `json:"nonce"`
+	StorageHash  common.Hash         `json:"storageHash"`
+	StorageProof []testStorageResult `json:"storageProof"`
+}
+
+// testProofBackend serves the proofs of the test state, whose root is
+// the state root of every block. If corrupt is set, the balances are
+// off by one.
+type testProofBackend struct {
+	testBackend
+	state   *testState
+	corrupt bool
+}
+
+func (b testProofBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	header := testHeader(testNumber(number))
+	header.Root = b.state.accounts.Hash()
+
+	return marshalBlock(header)
+}
+
+func (b testProofBackend) GetProof(address common.Address, keys []string, block rpc.BlockNumberOrHash) (*testAccountResult, error) {
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	var (
+		nonce = uint64(address[common.AddressLength-1])
+		res   = &testAccountResult{
+			Address:     address,
+			Balance:     (*hexutil.Big)(new(big.Int).SetUint64(nonce * 100)),
+			CodeHash:    emptyCodeHash,
+			Nonce:       hexutil.Uint64(nonce),
+			StorageHash: types.EmptyRootHash,
+		}
+		proof proofList
+	)
+
+	if err := b.state.accounts.Prove(crypto.Keccak256(address.Bytes()), 0, &proof); err != nil {
+		return nil, err
+	}
+	res.AccountProof = proof
+
+	storage, ok := b.state.storage[address]
+	if ok {
+		res.StorageHash = storage.Hash()
+	} else {
+		res.Nonce, res.Balance = 0, (*hexutil.Big)(new(big.Int))
+	}
+
+	if b.corrupt {
+		res.Balance = (*hexutil.Big)(new(big.Int).Add(res.Balance.ToInt(), common.Big1))
+	}
+
+	for _, key := range keys {
+		var (
+			slot  = common.HexToHash(key)
+			value = new(big.Int)
+			proof proofList
+		)
+
+		if ok {
+			if slot.Big().Uint64() <= 2 {
+				value.SetUint64(slot.Big().Uint64() * nonce)
+			}
+			if err := storage.Prove(crypto.Keccak256(slot.Bytes()), 0, &proof); err != nil {
+				return nil, err
+			}
+		}
+
+		res.StorageProof = append(res.StorageProof, testStorageResult{key, (*hexutil.Big)(value), proof})
+	}
+
+	return res, nil
+}
+
+func TestProofsAt(t *testing.T) {
+	var (
+		addresses = testAddresses(4)
+		state     = newTestState(addresses[:3])
+		slots     = []common.Hash{testSlot(1), testSlot(2), testSlot(3)}
+	)
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 1
+	cfg.Endpoints = []string{
+		newTestNode(t, testProofBackend{state: state}, nil),
+		newTestNode(t, testProofBackend{state: state}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.ProofsAt(addresses, slots, big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(addresses) {
+		t.Fatalf("TestProofsAt: want %v got %v", len(addresses), len(res))
+	}
+
+	for i, address := range addresses {
+		nonce := uint64(i + 1)
+		// The last account doesn't exist.
+		if i == 3 {
+			nonce = 0
+		}
+
+		if res[address].Nonce != nonce {
+			t.Fatalf("TestProofsAt: want %v got %v", nonce, res[address].Nonce)
+		}
+		for k, storage := range res[address].StorageProof {
+			want := uint64(k+1) * nonce
+			if k == 2 {
+				want = 0
+			}
+			if storage.Value.Uint64() != want {
+				t.Fatalf("TestProofsAt: want %v got %v", want, storage.Value)
+			}
+		}
+	}
+
+	// The latest block.
+	if _, err := r.ProofsAt(addresses[:1], nil, nil); err != nil {
+		t.Fatalf("TestProofsAt: want %v got %v", nil, err)
+	}
+}
+
+func TestProofsAtInvalid(t *testing.T) {
+	var (
+		addresses = testAddresses(2)
+		state     = newTestState(addresses)
+	)
+
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testProofBackend{state: state, corrupt: true}, nil)}
+
+	r := newTestRedgla(t, cfg)
+
+	if _, err := r.ProofsAt(addresses, nil, big.NewInt(10)); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("TestProofsAtInvalid: want %v got %v", ErrInvalidData, err)
+	}
+}
+
+func TestProofsAtQuorum(t *testing.T) {
+	var (
+		addresses = testAddresses(2)
+		state     = newTestState(addresses)
+		// A state without the second account, served with its own root.
+		forged = newTestState(addresses[:1])
+	)
+
+	cfg := DefaultConfig()
+	cfg.Quorum = &Quorum{Size: 3, Agree: 2}
+	cfg.Endpoints = []string{
+		newTestNode(t, testProofBackend{state: forged}, nil),
+		newTestNode(t, testProofBackend{state: state}, nil),
+		newTestNode(t, testProofBackend{state: state}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.ProofsAt(addresses, nil, big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[addresses[1]].Nonce != 2 {
+		t.Fatalf("TestProofsAtQuorum: want %v got %v", 2, res[addresses[1]].Nonce)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var errInvalidQuorum = errors.New("invalid quorum")
+
+// Quorum is the number of nodes that must agree on every item of a
+// request before it is accepted.
+type Quorum struct {
+	// Number of live nodes each item is fetched from.
+	Size int
+
+	// Number of them that must return the same block hash, transaction
+	// or receipt contents.
+	Agree int
+}
+
+func (q *Quorum) validate() error {
+	if q.Size < 1 || q.Agree < 1 || q.Agree > q.Size {
+		return errInvalidQuorum
+	}
+	return nil
+}
+
+// QuorumError is returned when fewer nodes than Quorum.Agree return the
+// same result for an item.
+type QuorumError struct {
+	// The item, e.g. "block 100".
+	Item string
+
+	// Number of nodes returning the most common result, and the number
+	// required.
+	Agreed   int
+	Required int
+
+	// Names of the nodes whose result differs from the most common one.
+	Dissenters []string
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("quorum not reached for %s: %d of %d required nodes agree, dissenting: %s",
+		e.Item, e.Agreed, e.Required, strings.Join(e.Dissenters, ", "))
+}
+
+// quorum requests the n items to Quorum.Size nodes, tagged with tag if
+// it isn't empty, and passes the items agreed on by Quorum.Agree of them
+// to merge.
+func (r *Redgla) quorum(method string, tag string, n int, fn fetchFn, merge func(res *msg)) error {
+	q := r.cfg.Quorum
+
+	nodes, err := r.pickTagged(method, tag, math.MaxInt)
+	if err != nil {
+		return err
+	}
+	if len(nodes) < q.Agree {
+		return fmt.Errorf("%w: %d live nodes for a quorum of %d", ErrNoAliveNode, len(nodes), q.Agree)
+	}
+	if len(nodes) > q.Size {
+		nodes = nodes[:q.Size]
+	}
+
+	var (
+		res    = make([]map[interface{}]interface{}, len(nodes))
+		errs   = make([]error, len(nodes))
+		sample = make([]interface{}, len(nodes))
+		wg     sync.WaitGroup
+	)
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node EndpointConfig) {
+			defer wg.Done()
+
+			items := make(map[interface{}]interface{}, n)
+			// Each node takes the whole request, split by its own
+			// BatchSize.
+			errs[i] = r.scatter([]EndpointConfig{node}, [][2]int{{0, n}}, fn, func(m *msg) {
+				iter := reflect.ValueOf(m.v).MapRange()
+				for iter.Next() {
+					items[iter.Key().Interface()] = iter.Value().Interface()
+				}
+				sample[i] = m.v
+			})
+			res[i] = items
+		}(i, node)
+	}
+	wg.Wait()
+
+	// Too few responses to reach the quorum, the failures are the cause.
+	if len(nodes)-failures(errs) < q.Agree {
+		return errs[firstFailure(errs)]
+	}
+
+	var (
+		first    = firstSuccess(errs)
+		accepted = reflect.MakeMapWithSize(reflect.TypeOf(sample[first]), n)
+		keys     = make(map[interface{}]interface{}, n)
+	)
+
+	// Every item returned by any node is voted on; the nodes leaving it
+	// out disagree.
+	for i := range nodes {
+		if errs[i] != nil {
+			continue
+		}
+		for key, v := range res[i] {
+			if _, ok := keys[key]; !ok {
+				keys[key] = v
+			}
+		}
+	}
+
+	for key, v := range keys {
+		var (
+			votes = make(map[common.Hash]int)
+			best  common.Hash
+		)
+
+		for i := range nodes {
+			if errs[i] != nil {
+				continue
+			}
+			if v, ok := res[i][key]; ok {
+				d := digest(v)
+				if votes[d]++; votes[d] > votes[best] {
+					best = d
+				}
+			}
+		}
+
+		if votes[best] < q.Agree {
+			qerr := &QuorumError{Item: describe(key, v), Agreed: votes[best], Required: q.Agree}
+			for i, node := range nodes {
+				if v, ok := res[i][key]; errs[i] == nil && (!ok || digest(v) != best) {
+					qerr.Dissenters = append(qerr.Dissenters, node.name())
+				}
+			}
+			return qerr
+		}
+
+		for i := range nodes {
+			if v, ok := res[i][key]; errs[i] == nil && ok && digest(v) == best {
+				accepted.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(v))
+				break
+			}
+		}
+	}
+
+	merge(&msg{"quorum", nil, accepted.Interface()})
+	return nil
+}
+
+func firstSuccess(errs []error) int {
+	for i, err := range errs {
+		if err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+func firstFailure(errs []error) int {
+	for i, err := range errs {
+		if err != nil {
+			return i
+		}
+	}
+	return 0
+}
+
+func failures(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// digest identifies the contents of an item.
+func digest(v interface{}) common.Hash {
+	switch v := v.(type) {
+	case *types.Block:
+		return chainHash(v)
+	case *types.Header:
+		return headerHash(v)
+	case *types.Transaction:
+		return v.Hash()
+	case *types.Receipt:
+		// The consensus encoding and the block it is included in.
+		b, _ := v.MarshalBinary()
+		return crypto.Keccak256Hash(b, v.BlockHash.Bytes(), v.TxHash.Bytes())
+	}
+
+	b, _ := json.Marshal(v)
+	return crypto.Keccak256Hash(b)
+}
+
+func describe(key interface{}, v interface{}) string {
+	switch v.(type) {
+	case *types.Block:
+		return fmt.Sprintf("block %v", key)
+	case *types.Header:
+		return fmt.Sprintf("header %v", key)
+	case *types.Transaction:
+		return fmt.Sprintf("transaction %v", key)
+	case *types.Receipt:
+		return fmt.Sprintf("receipt %v", key)
+	}
+	return fmt.Sprintf("item %v", key)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuorumValidation(t *testing.T) {
+	tests := []Quorum{{0, 0}, {2, 3}, {2, 0}}
+
+	for _, test := range tests {
+		if err := test.validate(); !errors.Is(err, errInvalidQuorum) {
+			t.Fatalf("TestQuorumValidation: want %v got %v", errInvalidQuorum, err)
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Quorum = &Quorum{Size: 3, Agree: 2}
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, nil), Name: "honest-1"},
+		{URL: newTestNode(t, testBackend{}, nil), Name: "honest-2", BatchSize: 4},
+		{URL: newTestNode(t, testForkBackend{from: 110}, nil), Name: "fork"},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	blocks, err := r.BlockByRangeWithBatch(100, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := uint64(100); n <= 120; n++ {
+		if blocks[n].Hash() != testHeader(n).Hash() {
+			t.Fatalf("TestQuorum: block %d: want %v got %v", n, testHeader(n).Hash(), blocks[n].Hash())
+		}
+	}
+
+	// Every node must agree.
+	strict := DefaultConfig()
+	strict.Quorum = &Quorum{Size: 3, Agree: 3}
+	strict.EndpointConfigs = cfg.EndpointConfigs
+
+	r = newTestRedgla(t, strict)
+
+	_, err = r.BlockByRange(105, 115)
+
+	var qerr *QuorumError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("TestQuorum: want %T got %v", qerr, err)
+	}
+	if len(qerr.Dissenters) != 1 || qerr.Dissenters[0] != "fork" {
+		t.Fatalf("TestQuorum: want %v got %v", []string{"fork"}, qerr.Dissenters)
+	}
+}
+
+// testItemsBackend returns its items, keyed by their index.
+type testItemsBackend struct {
+	items []int
+}
+
+func (b testItemsBackend) Items() []int {
+	return b.items
+}
+
+func TestQuorumMissingItems(t *testing.T) {
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		var items []int
+		if err := client.rpc.CallContext(context.Background(), &items, "test_items"); err != nil {
+			return nil, err
+		}
+
+		res := make(map[int]int, len(items))
+		for i, item := range items {
+			res[i] = item
+		}
+		return res, nil
+	}
+
+	endpoints := []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "test": testItemsBackend{[]int{7}}}, nil), Name: "partial"},
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "test": testItemsBackend{[]int{7, 8}}}, nil)},
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "test": testItemsBackend{[]int{7, 8}}}, nil)},
+	}
+
+	cfg := DefaultConfig()
+	cfg.Quorum = &Quorum{Size: 3, Agree: 2}
+	cfg.EndpointConfigs = endpoints
+
+	r := newTestRedgla(t, cfg)
+
+	// Whichever node answers first, the items of any node are voted on.
+	for i := 0; i < 5; i++ {
+		var res map[int]int
+		if err := r.quorum("test_items", "", 2, fn, func(m *msg) { res = m.v.(map[int]int) }); err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 2 || res[0] != 7 || res[1] != 8 {
+			t.Fatalf("TestQuorumMissingItems: want %v got %v", map[int]int{0: 7, 1: 8}, res)
+		}
+	}
+
+	strict := DefaultConfig()
+	strict.Quorum = &Quorum{Size: 3, Agree: 3}
+	strict.EndpointConfigs = endpoints
+
+	r = newTestRedgla(t, strict)
+
+	// The node leaving an item out disagrees on it.
+	err := r.quorum("test_items", "", 2, fn, func(*msg) {})
+
+	var qerr *QuorumError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("TestQuorumMissingItems: want %T got %v", qerr, err)
+	}
+	if len(qerr.Dissenters) != 1 || qerr.Dissenters[0] != "partial" {
+		t.Fatalf("TestQuorumMissingItems: want %v got %v", []string{"partial"}, qerr.Dissenters)
+	}
+}
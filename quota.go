@@ -0,0 +1,236 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// CostTable returns the units a JSON-RPC method costs. Hosted providers
+// bill each method with a different weight (e.g. compute units).
+type CostTable interface {
+	Cost(method string) uint64
+}
+
+// MethodCosts is a CostTable listing the cost of each method. Methods
+// that are not listed cost 1.
+type MethodCosts map[string]uint64
+
+func (m MethodCosts) Cost(method string) uint64 {
+	if cost, ok := m[method]; ok {
+		return cost
+	}
+	return 1
+}
+
+// Quota is the budget of an endpoint. Periods are calendar days and
+// months in UTC.
+type Quota struct {
+	// Cost of each method. If nil, every method costs 1.
+	Costs CostTable
+
+	// Units that can be spent per day. If zero, it is unlimited.
+	Daily uint64
+
+	// Units that can be spent per month. If zero, it is unlimited.
+	Monthly uint64
+}
+
+// Usage is the units spent on an endpoint in the current periods.
+type Usage struct {
+	Daily   uint64
+	Monthly uint64
+}
+
+type quota struct {
+	limit Quota
+	used  Usage
+
+	day   int // days since the epoch of used.Daily
+	month int // months since year 0 of used.Monthly
+}
+
+func (q *quota) cost(method string) uint64 {
+	if q.limit.Costs == nil {
+		return 1
+	}
+	return q.limit.Costs.Cost(method)
+}
+
+// roll resets the usage of the periods that are over.
+func (q *quota) roll(now time.Time) {
+	now = now.UTC()
+
+	if day := int(now.Unix() / 86400); day != q.day {
+		q.day, q.used.Daily = day, 0
+	}
+	if month := now.Year()*12 + int(now.Month()); month != q.month {
+		q.month, q.used.Monthly = month, 0
+	}
+}
+
+func (q *quota) affordable(units uint64) bool {
+	if q.limit.Daily != 0 && q.used.Daily+units > q.limit.Daily {
+		return false
+	}
+	if q.limit.Monthly != 0 && q.used.Monthly+units > q.limit.Monthly {
+		return false
+	}
+	return true
+}
+
+// quotas tracks the consumption of the endpoints that have a Quota.
+type quotas struct {
+	mu sync.Mutex
+	m  map[string]*quota
+}
+
+func newQuotas(endpoints []EndpointConfig) *quotas {
+	q := &quotas{m: make(map[string]*quota)}
+	for _, endpoint := range endpoints {
+		q.set(endpoint)
+	}
+	return q
+}
+
+// set replaces the quota of the endpoint. The units spent in the current
+// periods are kept.
+func (q *quotas) set(endpoint EndpointConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if endpoint.Quota == nil {
+		delete(q.m, endpoint.URL)
+		return
+	}
+
+	if quota, ok := q.m[endpoint.URL]; ok {
+		quota.limit = *endpoint.Quota
+		return
+	}
+	q.m[endpoint.URL] = newQuota(*endpoint.Quota)
+}
+
+func newQuota(q Quota) *quota {
+	return &quota{limit: q, day: -1, month: -1}
+}
+
+// cost returns the units the method costs on the endpoint.
+func (q *quotas) cost(endpoint string, method string) uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quota, ok := q.m[endpoint]
+	if !ok {
+		return 0
+	}
+	return quota.cost(method)
+}
+
+// costliest returns the method of the methods, which must not be empty,
+// that costs the most on any endpoint.
+func (q *quotas) costliest(methods []string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var (
+		res  = methods[0]
+		most uint64
+	)
+
+	for _, method := range methods {
+		for _, quota := range q.m {
+			if cost := quota.cost(method); cost > most {
+				res, most = method, cost
+			}
+		}
+	}
+
+	return res
+}
+
+// affordable reports whether the endpoint has budget left for the method.
+func (q *quotas) affordable(endpoint string, method string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quota, ok := q.m[endpoint]
+	if !ok {
+		return true
+	}
+
+	quota.roll(time.Now())
+	return quota.affordable(quota.cost(method))
+}
+
+// charge spends the cost of the methods from the budget of the
+// endpoint. Nothing is spent if the budget is not enough for all of them.
+func (q *quotas) charge(endpoint string, methods []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quota, ok := q.m[endpoint]
+	if !ok {
+		return nil
+	}
+
+	quota.roll(time.Now())
+
+	var units uint64
+	for _, method := range methods {
+		units += quota.cost(method)
+	}
+
+	if !quota.affordable(units) {
+		return ErrQuotaExhausted
+	}
+
+	quota.used.Daily += units
+	quota.used.Monthly += units
+
+	return nil
+}
+
+func (q *quotas) usage() map[string]Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	res := make(map[string]Usage, len(q.m))
+	for endpoint, quota := range q.m {
+		quota.roll(time.Now())
+		res[endpoint] = quota.used
+	}
+	return res
+}
+
+// requestMethods returns the methods called by a JSON-RPC request body,
+// which is either a single call or a batch.
+func requestMethods(body []byte) []string {
+	type call struct {
+		Method string `json:"method"`
+	}
+
+	var batch []call
+	if err := json.Unmarshal(body, &batch); err == nil {
+		res := make([]string, 0, len(batch))
+		for _, c := range batch {
+			res = append(res, c.Method)
+		}
+		return res
+	}
+
+	var single call
+	if err := json.Unmarshal(body, &single); err == nil && single.Method != "" {
+		return []string{single.Method}
+	}
+
+	return nil
+}
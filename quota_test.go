@@ -0,0 +1,191 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestMethods(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`, []string{"eth_chainId"}},
+		{`[{"method":"eth_getBlockByNumber"},{"method":"eth_getTransactionReceipt"}]`, []string{"eth_getBlockByNumber", "eth_getTransactionReceipt"}},
+		{`dbadoy`, nil},
+	}
+
+	for _, test := range tests {
+		got := requestMethods([]byte(test.body))
+		if len(got) != len(test.want) {
+			t.Fatalf("TestRequestMethods: want %v got %v", test.want, got)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("TestRequestMethods: want %v got %v", test.want, got)
+			}
+		}
+	}
+}
+
+func TestQuotaCharge(t *testing.T) {
+	q := newQuotas([]EndpointConfig{
+		{URL: "a", Quota: &Quota{Costs: MethodCosts{"eth_getBlockByNumber": 16}, Daily: 40, Monthly: 100}},
+	})
+
+	if err := q.charge("a", []string{"eth_getBlockByNumber", "eth_chainId"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := q.usage()["a"].Daily; got != 17 {
+		t.Fatalf("TestQuotaCharge: want %v got %v", 17, got)
+	}
+
+	if err := q.charge("a", []string{"eth_getBlockByNumber", "eth_getBlockByNumber"}); !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("TestQuotaCharge: want %v got %v", ErrQuotaExhausted, err)
+	}
+	// A refused request spends nothing.
+	if got := q.usage()["a"].Daily; got != 17 {
+		t.Fatalf("TestQuotaCharge: want %v got %v", 17, got)
+	}
+
+	if !q.affordable("a", "eth_getBlockByNumber") {
+		t.Fatal("TestQuotaCharge: budget is left")
+	}
+
+	// Endpoints without a quota are not tracked.
+	if err := q.charge("b", []string{"eth_getBlockByNumber"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.usage()["b"]; ok {
+		t.Fatal("TestQuotaCharge: endpoint without a quota is tracked")
+	}
+}
+
+func TestQuotaCostliest(t *testing.T) {
+	q := newQuotas([]EndpointConfig{
+		{URL: "a", Quota: &Quota{Costs: MethodCosts{"eth_getBlockByNumber": 16}}},
+		{URL: "b", Quota: &Quota{Costs: MethodCosts{"trace_block": 40}}},
+	})
+
+	tests := []struct {
+		methods []string
+		want    string
+	}{
+		{[]string{"eth_chainId", "eth_getBlockByNumber"}, "eth_getBlockByNumber"},
+		{[]string{"eth_chainId", "eth_getBlockByNumber", "trace_block"}, "trace_block"},
+		{[]string{"eth_chainId", "eth_blockNumber"}, "eth_chainId"},
+	}
+
+	for _, test := range tests {
+		if got := q.costliest(test.methods); got != test.want {
+			t.Fatalf("TestQuotaCostliest: want %v got %v", test.want, got)
+		}
+	}
+}
+
+func TestQuotaRoll(t *testing.T) {
+	q := newQuota(Quota{Daily: 10})
+
+	now := time.Date(2023, 3, 31, 23, 0, 0, 0, time.UTC)
+	q.roll(now)
+	q.used = Usage{Daily: 10, Monthly: 10}
+
+	q.roll(now.Add(30 * time.Minute))
+	if q.used.Daily != 10 {
+		t.Fatalf("TestQuotaRoll: want %v got %v", 10, q.used.Daily)
+	}
+
+	q.roll(now.Add(2 * time.Hour))
+	if q.used.Daily != 0 || q.used.Monthly != 0 {
+		t.Fatalf("TestQuotaRoll: want %v got %v", Usage{}, q.used)
+	}
+}
+
+func TestQuotaRouting(t *testing.T) {
+	var served [2]uint32
+
+	count := func(i int) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddUint32(&served[i], 1)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, count(0)),
+		newTestNode(t, testBackend{}, count(1)),
+	}
+	// The heartbeat spends 3 eth_getBlockByNumber on the heights.
+	cfg.Quotas = map[string]Quota{
+		cfg.Endpoints[0]: {Costs: MethodCosts{"eth_getBlockByNumber": 10}, Daily: 80},
+		cfg.Endpoints[1]: {Costs: MethodCosts{"eth_getBlockByNumber": 1}, Daily: 6},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Ignore the heartbeat.
+	atomic.StoreUint32(&served[0], 0)
+	atomic.StoreUint32(&served[1], 0)
+
+	// The cheaper node is preferred until its budget is exhausted.
+	if _, err := r.BlockByRange(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if served[0] != 0 || served[1] != 3 {
+		t.Fatalf("TestQuotaRouting: want %v got %v", [2]uint32{0, 3}, served)
+	}
+
+	if _, err := r.BlockByRange(0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if served[0] != 5 || served[1] != 3 {
+		t.Fatalf("TestQuotaRouting: want %v got %v", [2]uint32{5, 3}, served)
+	}
+
+	if _, err := r.BlockByRange(0, 0); !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("TestQuotaRouting: want %v got %v", ErrQuotaExhausted, err)
+	}
+
+	usage := r.Usage()
+	if usage[cfg.Endpoints[0]].Daily != 80 || usage[cfg.Endpoints[1]].Daily != 6 {
+		t.Fatalf("TestQuotaRouting: unexpected usage %v", usage)
+	}
+}
+
+func TestQuotaHeartbeat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, nil)}
+	cfg.Quotas = map[string]Quota{
+		cfg.Endpoints[0]: {Costs: MethodCosts{"eth_chainId": 2}, Daily: 100},
+	}
+
+	r, err := New(DefaultHeartbeatFn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Run()
+	t.Cleanup(r.Stop)
+
+	for i := 0; len(r.list.liveNodes()) != 1; i++ {
+		if i == 100 {
+			t.Fatal("heartbeat is not over")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := r.Usage()[cfg.Endpoints[0]].Daily; got < 2 {
+		t.Fatalf("TestQuotaHeartbeat: want %v got %v", 2, got)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Backoff applied to an endpoint that answers 429 without a valid
+// Retry-After header.
+const defaultRetryAfter = time.Second
+
+// RateLimit is a token bucket limit of the requests sent to an endpoint.
+type RateLimit struct {
+	// Number of requests per second allowed to the endpoint.
+	Rate float64
+
+	// Number of requests that can be sent at once before being limited
+	// by Rate. If zero, it is 1.
+	Burst int
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate <= 0 || l.Burst < 0 {
+		return errInvalidRateLimit
+	}
+	return nil
+}
+
+// limiter is a token bucket.
+type limiter struct {
+	mu sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(l RateLimit) *limiter {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &limiter{
+		rate:   l.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller has to wait
+// before using it.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel gives back a token taken by reserve.
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// throttle keeps the rate limit of each endpoint and the endpoints
+// that asked us to back off.
+type throttle struct {
+	mu       sync.RWMutex
+	limiters map[string]*limiter
+	until    map[string]time.Time
+}
+
+func newThrottle(endpoints []EndpointConfig) *throttle {
+	t := &throttle{
+		limiters: make(map[string]*limiter),
+		until:    make(map[string]time.Time),
+	}
+
+	for _, endpoint := range endpoints {
+		t.set(endpoint)
+	}
+
+	return t
+}
+
+// set replaces the rate limit of the endpoint.
+func (t *throttle) set(endpoint EndpointConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if endpoint.RateLimit == nil {
+		delete(t.limiters, endpoint.URL)
+		return
+	}
+	t.limiters[endpoint.URL] = newLimiter(*endpoint.RateLimit)
+}
+
+// wait blocks until a request can be sent to the endpoint.
+func (t *throttle) wait(ctx context.Context, endpoint string) error {
+	t.mu.RLock()
+	l, ok := t.limiters[endpoint]
+	t.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return l.wait(ctx)
+}
+
+// backoff stops sending requests to the endpoint for d.
+func (t *throttle) backoff(endpoint string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(t.until[endpoint]) {
+		t.until[endpoint] = until
+	}
+}
+
+// throttled reports whether the endpoint is backing off.
+func (t *throttle) throttled(endpoint string) bool {
+	t.mu.RLock()
+	until, ok := t.until[endpoint]
+	t.mu.RUnlock()
+
+	return ok && time.Now().Before(until)
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(v); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+
+	return defaultRetryAfter
+}
+
+// isRateLimited reports whether the error is the endpoint refusing the
+// request because of its rate limit.
+func isRateLimited(err error) bool {
+	var httpErr rpc.HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(RateLimit{Rate: 100, Burst: 5})
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 5 requests are sent at once, the other 5 wait 10ms each.
+	if spent := time.Since(start); spent < 40*time.Millisecond {
+		t.Fatalf("TestLimiter: too fast, %v", spent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	l = newLimiter(RateLimit{Rate: 0.1, Burst: 1})
+	if err := l.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(ctx); err == nil {
+		t.Fatal("TestLimiter: want context error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"3", 3 * time.Second},
+		{"", defaultRetryAfter},
+		{"-1", defaultRetryAfter},
+		{"dbadoy", defaultRetryAfter},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), defaultRetryAfter},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.v); got != test.want {
+			t.Fatalf("TestParseRetryAfter: want %v got %v", test.want, got)
+		}
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 59*time.Minute {
+		t.Fatalf("TestParseRetryAfter: want about %v got %v", time.Hour, got)
+	}
+}
+
+func TestRateLimitedNodeShiftsWork(t *testing.T) {
+	var refused uint32
+
+	tooManyRequests := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint32(&refused, 1)
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, tooManyRequests),
+		newTestNode(t, testBackend{}, nil),
+	}
+	cfg.RateLimits = map[string]RateLimit{
+		cfg.Endpoints[1]: {Rate: 1000, Burst: 10},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	blocks, err := r.BlockByRangeWithBatch(0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 21 {
+		t.Fatalf("TestRateLimitedNodeShiftsWork: want %v got %v", 21, len(blocks))
+	}
+
+	if !r.throttle.throttled(cfg.Endpoints[0]) {
+		t.Fatal("TestRateLimitedNodeShiftsWork: refusing node is not backing off")
+	}
+
+	// The node backing off is no longer selected.
+	n := atomic.LoadUint32(&refused)
+	if _, err := r.BlockByRange(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadUint32(&refused) != n {
+		t.Fatal("TestRateLimitedNodeShiftsWork: request is sent to the node backing off")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rawResult is the response of a call of BatchCallContext.
+type rawResult struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// CallContext calls the JSON-RPC method with the arguments on a live node,
+// like rpc.Client.CallContext, and stores the result into result, which
+// must be a pointer or nil. The node is picked like for the requests of
+// the other methods, and the request is retried on the next node if the
+// node is rate limited or out of quota. It works with any method,
+// including those the nodes of some chains add.
+func (r *Redgla) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var raw json.RawMessage
+		if err := client.rpc.CallContext(ctx, &raw, method, args...); err != nil {
+			return nil, err
+		}
+		return map[int]json.RawMessage{0: raw}, nil
+	}
+
+	// The result is decoded once the node is settled on, the nodes of a
+	// quorum would write it concurrently otherwise.
+	var raw json.RawMessage
+
+	err := r.collect(method, 1, false, fn, func(m *msg) {
+		raw = m.rawResponse()[0]
+	})
+	if err != nil {
+		return err
+	}
+
+	if result == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// BatchCallContext sends the calls like rpc.Client.BatchCallContext. The
+// batch is split over the live nodes if it has more calls than the
+// Threshold, and further by EndpointConfig.BatchSize. As with
+// rpc.Client.BatchCallContext, the error is only returned if the batch
+// can't be sent; the errors of the calls are set in their Error field.
+func (r *Redgla) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		select {
+		case _, ok := <-quit:
+			if !ok {
+				return nil, ErrBatchFailure
+			}
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var (
+			batch = make([]rpc.BatchElem, hi-lo)
+			raws  = make([]json.RawMessage, hi-lo)
+		)
+
+		for i := range batch {
+			batch[i] = rpc.BatchElem{Method: b[lo+i].Method, Args: b[lo+i].Args, Result: &raws[i]}
+		}
+
+		if err := client.rpc.BatchCallContext(ctx, batch); err != nil {
+			return nil, err
+		}
+
+		res := make(map[int]rawResult, hi-lo)
+		for i, elem := range batch {
+			res[lo+i] = rawResult{raws[i], elem.Error}
+		}
+		return res, nil
+	}
+
+	methods := make([]string, len(b))
+	for i, elem := range b {
+		methods[i] = elem.Method
+	}
+
+	// The nodes are picked by the costliest method of the batch for the
+	// quotas, the whole batch is charged as it is sent.
+	results := make(map[int]rawResult, len(b))
+
+	err := r.collect(r.quotas.costliest(methods), len(b), true, fn, func(m *msg) {
+		for k, v := range m.rawBatchResponse() {
+			results[k] = v
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range b {
+		res := results[i]
+
+		switch {
+		case res.Err != nil:
+			b[i].Error = res.Err
+		case b[i].Result != nil && len(res.Result) != 0:
+			b[i].Error = json.Unmarshal(res.Result, b[i].Result)
+		}
+	}
+
+	return nil
+}
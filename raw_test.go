@@ -0,0 +1,88 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testCustomBackend is a namespace the client doesn't know.
+type testCustomBackend struct{}
+
+func (testCustomBackend) Echo(s string, n int) string {
+	return fmt.Sprintf("%s-%d", s, n)
+}
+
+func TestCallContext(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{
+		newTestServer(t, map[string]interface{}{"eth": testBackend{}, "custom": testCustomBackend{}}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	var chainID hexutil.Big
+	if err := r.CallContext(context.Background(), &chainID, "eth_chainId"); err != nil {
+		t.Fatal(err)
+	}
+	if chainID.ToInt().Uint64() != 1 {
+		t.Fatalf("TestCallContext: want %v got %v", 1, chainID.ToInt())
+	}
+
+	var echo string
+	if err := r.CallContext(context.Background(), &echo, "custom_echo", "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if echo != "a-1" {
+		t.Fatalf("TestCallContext: want %v got %v", "a-1", echo)
+	}
+
+	if err := r.CallContext(context.Background(), nil, "custom_missing"); err == nil {
+		t.Fatalf("TestCallContext: want %v got %v", "error", err)
+	}
+}
+
+func TestBatchCallContext(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestServer(t, map[string]interface{}{"eth": testBackend{}, "custom": testCustomBackend{}}, nil),
+		newTestServer(t, map[string]interface{}{"eth": testBackend{}, "custom": testCustomBackend{}}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	var (
+		batch   = make([]rpc.BatchElem, 20)
+		results = make([]string, len(batch))
+	)
+
+	for i := range batch {
+		batch[i] = rpc.BatchElem{Method: "custom_echo", Args: []interface{}{"b", i}, Result: &results[i]}
+	}
+	batch[7].Method = "custom_missing"
+
+	if err := r.BatchCallContext(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, elem := range batch {
+		if i == 7 {
+			if elem.Error == nil {
+				t.Fatalf("TestBatchCallContext: want %v got %v", "error", elem.Error)
+			}
+			continue
+		}
+		if want := fmt.Sprintf("b-%d", i); elem.Error != nil || results[i] != want {
+			t.Fatalf("TestBatchCallContext: want %v got %v (%v)", want, results[i], elem.Error)
+		}
+	}
+}
@@ -9,26 +9,59 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var (
-	ErrNoAliveNode  = errors.New("there is no alive node")
-	ErrBatchFailure = errors.New("batch request failure")
+	ErrNoAliveNode   = errors.New("there is no alive node")
+	ErrBatchFailure  = errors.New("batch request failure")
+	ErrUnknownHeight = errors.New("unknown block height")
+
+	errInvalidBlockTag = errors.New("invalid block tag")
 )
 
+// Redgla is safe for concurrent use. Concurrent requests of the same
+// blocks, transactions, receipts, uncles, transaction counts, and
+// balances and nonces at a block number are sent once and shared; those
+// of the other methods, such as the call, trace and fee methods and the
+// state at a tag, are sent as they come.
 type Redgla struct {
 	isRun uint32
 
 	list *beater
 	cfg  *Config
+
+	selector Selector
+	inflight *inflight
+	throttle *throttle
+	quotas   *quotas
+
+	cache   *cache
+	store   *store
+	flights *flights
+	tip     tip
+}
+
+// tip is the last known block number of the chain.
+type tip struct {
+	mu      sync.Mutex
+	number  uint64
+	updated time.Time
 }
 
 func New(fn HeartbeatFn, cfg *Config) (*Redgla, error) {
@@ -44,12 +77,44 @@ func New(fn HeartbeatFn, cfg *Config) (*Redgla, error) {
 		return nil, err
 	}
 
-	beater, err := newBeater("beater", cfg.Endpoints, fn, cfg.HeartbeatInterval, cfg.HeartbeatTimeout)
+	var (
+		endpoints = cfg.endpoints()
+		throttle  = newThrottle(endpoints)
+	)
+
+	beater, err := newBeater("beater", endpoints, fn, throttle, cfg.HeartbeatInterval, cfg.HeartbeatTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Redgla{0, beater, cfg}, nil
+	selector := cfg.Selector
+	if selector == nil {
+		selector = NewFastestFirstSelector()
+	}
+
+	store, err := openStore(cfg.DiskCache)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Redgla{
+		list:     beater,
+		cfg:      cfg,
+		selector: selector,
+		inflight: newInflight(),
+		throttle: throttle,
+		quotas:   newQuotas(endpoints),
+		cache:    newCache(cfg.Cache),
+		store:    store,
+		flights:  newFlights(),
+	}
+
+	// Heartbeats are charged to the quotas like the requests, and
+	// request the heights of the nodes along.
+	beater.dialOptions = r.dialOptions
+	beater.track = r.heights
+
+	return r, nil
 }
 
 func (r *Redgla) Run() {
@@ -66,20 +131,54 @@ func (r *Redgla) Stop() {
 	}
 }
 
+// Close stops the Redgla and closes the disk cache. It must not be used
+// afterwards.
+func (r *Redgla) Close() error {
+	r.Stop()
+	return r.store.close()
+}
+
 // AddNode adds the target endpoint to the list of batch processing nodes.
 // The endpoint entered will take effect starting from the next
 // HeartbeatInterval.
 func (r *Redgla) AddNode(endpoint string) error {
-	return r.list.add(endpoint)
+	return r.AddEndpoint(EndpointConfig{URL: endpoint})
 }
 
-// DelNode removes the target endpoint from the list of batch processing
-// nodes. Removed endpoints take effect from the next HeartbeatInterval.
+// AddEndpoint is AddNode with the settings of the endpoint.
+func (r *Redgla) AddEndpoint(endpoint EndpointConfig) error {
+	endpoint = r.cfg.endpoint(endpoint)
+
+	if err := r.list.add(endpoint); err != nil {
+		return err
+	}
+
+	r.throttle.set(endpoint)
+	r.quotas.set(endpoint)
+
+	return nil
+}
+
+// DelNode removes the target endpoint, given by its URL or name, from
+// the list of batch processing nodes. Removed endpoints take effect from
+// the next HeartbeatInterval.
 func (r *Redgla) DelNode(endpoint string) error {
 	return r.list.delete(endpoint)
 }
 
-// Benchmark measures and returns the response time of each node.
+// Usage returns the units spent in the current periods on each endpoint
+// that has a Quota, keyed by the name of the endpoint.
+func (r *Redgla) Usage() map[string]Usage {
+	res := make(map[string]Usage)
+	for endpoint, usage := range r.quotas.usage() {
+		cfg := r.endpoint(endpoint)
+		res[cfg.name()] = usage
+	}
+	return res
+}
+
+// Benchmark measures and returns the response time of each node, keyed
+// by the name of the node (see EndpointConfig.Name).
 //
 // Batch request performance is matched to the speed of the slowest node.
 // Removing nodes that are too slow to respond from the list can help
@@ -92,9 +191,21 @@ func (r *Redgla) Benchmark(height uint64, cnt int) (map[string]time.Duration, er
 		return nil, ErrNoAliveNode
 	}
 
-	clients, err := r.dial(nodes)
-	if err != nil {
-		return nil, err
+	var (
+		configs = make([]EndpointConfig, 0, len(nodes))
+		clients = make([]*conn, 0, len(nodes))
+	)
+
+	for _, node := range nodes {
+		cfg := r.endpoint(node)
+
+		client, err := r.dial(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		configs = append(configs, cfg)
+		clients = append(clients, client)
 	}
 
 	var (
@@ -103,7 +214,7 @@ func (r *Redgla) Benchmark(height uint64, cnt int) (map[string]time.Duration, er
 	)
 
 	for i := 0; i < len(clients); i++ {
-		go func(client *ethclient.Client, endpoint string) {
+		go func(client *conn, node EndpointConfig) {
 			start := time.Now()
 			// Requesting for the same block number results in a faster
 			// response time (it seems to be cached), so we ask for a
@@ -112,12 +223,12 @@ func (r *Redgla) Benchmark(height uint64, cnt int) (map[string]time.Duration, er
 			for i := 0; i < cnt; i++ {
 				_, err := client.BlockByNumber(context.Background(), big.NewInt(randBN))
 				if err != nil {
-					resc <- &msg{endpoint, err, 0}
+					resc <- &msg{node.name(), redactError(err, node), 0}
 					return
 				}
 			}
-			resc <- &msg{endpoint, nil, time.Since(start)}
-		}(clients[i], nodes[i])
+			resc <- &msg{node.name(), nil, time.Since(start)}
+		}(clients[i], configs[i])
 	}
 
 	for i := 0; i < cap(resc); i++ {
@@ -133,221 +244,780 @@ func (r *Redgla) Benchmark(height uint64, cnt int) (map[string]time.Duration, er
 
 // BlockByRange requests blocks from a range to a node.
 func (r *Redgla) BlockByRange(start uint64, end uint64) (map[uint64]*types.Block, error) {
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+	return r.blockByRange(start, end, false)
+}
+
+// BlockByRangeWithBatch transmits and receives batch requests to
+// healthy nodes among the list of registered nodes.
+func (r *Redgla) BlockByRangeWithBatch(start uint64, end uint64) (map[uint64]*types.Block, error) {
+	return r.blockByRange(start, end, true)
+}
+
+// BlockByRangeTo is BlockByRange whose end may also be one of the tags
+// rpc.LatestBlockNumber, rpc.SafeBlockNumber and rpc.FinalizedBlockNumber.
+// A tag is the lowest height of it among the live nodes, so that every
+// live node has the blocks. Until a heartbeat reports it, it is requested
+// to a live node, or fails with ErrUnknownHeight if
+// Config.ClampToFinalized is set.
+func (r *Redgla) BlockByRangeTo(start uint64, end rpc.BlockNumber) (map[uint64]*types.Block, error) {
+	last, err := r.resolve(end)
+	if err != nil {
+		return nil, err
+	}
+	return r.blockByRange(start, last, false)
+}
+
+// BlockByRangeToWithBatch is BlockByRangeWithBatch with the end of
+// BlockByRangeTo.
+func (r *Redgla) BlockByRangeToWithBatch(start uint64, end rpc.BlockNumber) (map[uint64]*types.Block, error) {
+	last, err := r.resolve(end)
+	if err != nil {
+		return nil, err
 	}
+	return r.blockByRange(start, last, true)
+}
 
-	clients, err := r.dial([]string{nodes[0]})
+func (r *Redgla) blockByRange(start uint64, end uint64, batch bool) (map[uint64]*types.Block, error) {
+	end, err := r.clamp(end)
 	if err != nil {
 		return nil, err
 	}
 
-	return blockByRange(clients[0], start, end, r.cfg.RequestTimeout, nil)
+	return r.blockByNumbers(makeRange(start, end), batch)
 }
 
-// BlockByRangeWithBatch transmits and receives batch requests to
-// healthy nodes among the list of registered nodes.
-func (r *Redgla) BlockByRangeWithBatch(start uint64, end uint64) (map[uint64]*types.Block, error) {
-	if r.cfg.Threshold >= int(end-start) {
-		return r.BlockByRange(start, end)
+func (r *Redgla) blockByNumbers(numbers []uint64, batch bool) (map[uint64]*types.Block, error) {
+	result := make(map[uint64]*types.Block, len(numbers))
+
+	// Only the blocks missing in the caches are requested.
+	numbers = r.cache.blocks(numbers, result)
+
+	stored, numbers := r.store.blocks(numbers, result)
+	r.keepBlocks(stored, false)
+
+	if len(numbers) == 0 {
+		return result, nil
 	}
 
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+	keys := make([]cacheKey, len(numbers))
+	for i, n := range numbers {
+		keys[i] = cacheKey{kind: kindBlock, number: n}
 	}
 
-	clients, err := r.dial(nodes)
+	// Concurrent callers share the request of each block.
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		numbers := make([]uint64, 0, len(own))
+		for _, i := range own {
+			numbers = append(numbers, keys[i].number)
+		}
+
+		res := make(map[cacheKey]interface{}, len(numbers))
+
+		err := r.collect("eth_getBlockByNumber", len(numbers), batch, r.fetchBlocks(numbers), func(m *msg) {
+			for k, v := range m.blockResponse() {
+				res[cacheKey{kind: kindBlock, number: k}] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		resc   = make(chan *msg, len(nodes))
-		result = make(map[uint64]*types.Block, end-start)
-	)
-
-	quit := make(chan struct{})
-	ranges := makeBatchRange(start, end, len(nodes))
-	for i, rg := range ranges {
-		go func(client *ethclient.Client, endpoint string, start uint64, end uint64) {
-			r, err := blockByRange(client, start, end, r.cfg.RequestTimeout, quit)
-			if err != nil {
-				resc <- &msg{endpoint, err, nil}
-				return
-			}
-			resc <- &msg{endpoint, nil, r}
-		}(clients[i], nodes[i], rg[0], rg[1])
+	for k, v := range fetched {
+		result[k.number] = v.(*types.Block)
 	}
 
-	for i := 0; i < cap(resc); i++ {
-		res := <-resc
-		if res.err != nil {
-			close(quit)
-			return nil, fmt.Errorf("%w: %s (%s)", res.err, res.endpoint, "request failed during batch operation")
+	if r.cfg.CheckParentHash {
+		if err := r.verifyChain(result); err != nil {
+			return nil, err
 		}
+	}
 
-		for k, v := range res.blockResponse() {
-			result[k] = v
-		}
+	// The blocks are kept once the chain is repaired, so that the blocks
+	// of a minority fork aren't.
+	kept := make(map[uint64]*types.Block, len(fetched))
+	for k := range fetched {
+		kept[k.number] = result[k.number]
 	}
+	r.keepBlocks(kept, true)
 
 	return result, nil
 }
 
 // TransactionByHashes requests transactions from given hashes to a node.
 func (r *Redgla) TransactionByHashes(hashes []common.Hash) (map[common.Hash]*types.Transaction, error) {
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+	return r.transactionByHashes(hashes, false)
+}
+
+// TransactionByHashesWithBatch transmits and receives batch requests to
+// healthy nodes among the list of registered nodes.
+func (r *Redgla) TransactionByHashesWithBatch(hashes []common.Hash) (map[common.Hash]*types.Transaction, error) {
+	return r.transactionByHashes(hashes, true)
+}
+
+func (r *Redgla) transactionByHashes(hashes []common.Hash, batch bool) (map[common.Hash]*types.Transaction, error) {
+	result := make(map[common.Hash]*types.Transaction, len(hashes))
+
+	hashes = r.cache.transactions(hashes, result)
+	if len(hashes) == 0 {
+		return result, nil
+	}
+
+	keys := make([]cacheKey, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = cacheKey{kind: kindTransaction, hash: hash}
 	}
 
-	clients, err := r.dial([]string{nodes[0]})
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		hashes := make([]common.Hash, 0, len(own))
+		for _, i := range own {
+			hashes = append(hashes, keys[i].hash)
+		}
+
+		res := make(map[cacheKey]interface{}, len(hashes))
+
+		err := r.collect("eth_getTransactionByHash", len(hashes), batch, r.fetchTransactions(hashes), func(m *msg) {
+			for k, v := range m.transactionResponse() {
+				res[cacheKey{kind: kindTransaction, hash: k}] = v
+				// A transaction never changes once its hash is known.
+				r.cache.addTransaction(v)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return transactionByHashes(clients[0], hashes, r.cfg.RequestTimeout, nil)
+	for k, v := range fetched {
+		result[k.hash] = v.(*types.Transaction)
+	}
+
+	return result, nil
 }
 
-// TransactionByHashesWithBatch transmits and receives batch requests to
+// ReceiptByTxs requests receipts from given transactions to a node.
+func (r *Redgla) ReceiptByTxs(txs []*types.Transaction) (map[common.Hash]*types.Receipt, error) {
+	return r.receiptByTxs(txs, false)
+}
+
+// ReceiptByTxsWithBatch transmits and receives batch requests to
 // healthy nodes among the list of registered nodes.
-func (r *Redgla) TransactionByHashesWithBatch(hashes []common.Hash) (map[common.Hash]*types.Transaction, error) {
-	if r.cfg.Threshold >= len(hashes) {
-		return r.TransactionByHashes(hashes)
+func (r *Redgla) ReceiptByTxsWithBatch(txs []*types.Transaction) (map[common.Hash]*types.Receipt, error) {
+	return r.receiptByTxs(txs, true)
+}
+
+func (r *Redgla) receiptByTxs(txs []*types.Transaction, batch bool) (map[common.Hash]*types.Receipt, error) {
+	result := make(map[common.Hash]*types.Receipt, len(txs))
+
+	txs = r.cache.receipts(txs, result)
+
+	stored, txs := r.store.receipts(txs, result)
+	r.keepReceipts(stored, false)
+
+	if len(txs) == 0 {
+		return result, nil
 	}
 
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+	keys := make([]cacheKey, len(txs))
+	for i, tx := range txs {
+		keys[i] = cacheKey{kind: kindReceipt, hash: tx.Hash()}
 	}
 
-	clients, err := r.dial(nodes)
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		pending := make([]*types.Transaction, 0, len(own))
+		for _, i := range own {
+			pending = append(pending, txs[i])
+		}
+
+		var (
+			receipts = make(map[common.Hash]*types.Receipt, len(pending))
+			res      = make(map[cacheKey]interface{}, len(pending))
+		)
+
+		err := r.collect("eth_getTransactionReceipt", len(pending), batch, r.fetchReceipts(pending), func(m *msg) {
+			for k, v := range m.receiptResponse() {
+				receipts[k] = v
+				res[cacheKey{kind: kindReceipt, hash: k}] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		r.keepReceipts(receipts, true)
+		return res, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		resc   = make(chan *msg, len(nodes))
-		result = make(map[common.Hash]*types.Transaction, len(hashes))
-	)
+	for k, v := range fetched {
+		result[k.hash] = v.(*types.Receipt)
+	}
+
+	return result, nil
+}
+
+// keepBlocks adds the final blocks to the memory cache, and to the disk
+// cache if persist is set. The blocks within the finality depth may be
+// reorged out, so they are not kept.
+func (r *Redgla) keepBlocks(blocks map[uint64]*types.Block, persist bool) {
+	if len(blocks) == 0 {
+		return
+	}
 
-	quit := make(chan struct{})
-	indices := makeBatchIndex(len(hashes), len(nodes))
-	for i, index := range indices {
-		go func(client *ethclient.Client, endpoint string, hashes []common.Hash) {
-			r, err := transactionByHashes(client, hashes, r.cfg.RequestTimeout, quit)
-			if err != nil {
-				resc <- &msg{endpoint, err, nil}
-				return
+	if r.cache != nil {
+		final, ok := r.finalized(r.cfg.Cache.finalityDepth())
+		for n, block := range blocks {
+			if ok && n <= final {
+				r.cache.addBlock(block)
 			}
-			resc <- &msg{endpoint, nil, r}
-		}(clients[i], nodes[i], hashes[index[0]:index[1]])
+		}
 	}
 
-	for i := 0; i < cap(resc); i++ {
-		res := <-resc
+	if !persist {
+		return
+	}
+
+	if r.store != nil {
+		final, ok := r.finalized(r.cfg.DiskCache.finalityDepth())
+		res := make([]*types.Block, 0, len(blocks))
+		for n, block := range blocks {
+			if ok && n <= final {
+				res = append(res, block)
+			}
+		}
+		// A failed write only costs a refetch.
+		r.store.putBlocks(res)
+	}
+}
+
+// keepReceipts is keepBlocks for receipts.
+func (r *Redgla) keepReceipts(receipts map[common.Hash]*types.Receipt, persist bool) {
+	if len(receipts) == 0 {
+		return
+	}
+
+	if r.cache != nil {
+		final, ok := r.finalized(r.cfg.Cache.finalityDepth())
+		for hash, receipt := range receipts {
+			if ok && receipt.BlockNumber != nil && receipt.BlockNumber.Uint64() <= final {
+				r.cache.addReceipt(hash, receipt)
+			}
+		}
+	}
+
+	if !persist {
+		return
+	}
+
+	if r.store != nil {
+		final, ok := r.finalized(r.cfg.DiskCache.finalityDepth())
+		res := make(map[common.Hash]*types.Receipt, len(receipts))
+		for hash, receipt := range receipts {
+			if ok && receipt.BlockNumber != nil && receipt.BlockNumber.Uint64() <= final {
+				res[hash] = receipt
+			}
+		}
+		r.store.putReceipts(res)
+	}
+}
+
+// resolve returns the block number of the tag, or the number itself. See
+// BlockByRangeTo for the tags.
+func (r *Redgla) resolve(tag rpc.BlockNumber) (uint64, error) {
+	if tag >= 0 {
+		return uint64(tag), nil
+	}
+
+	name, _ := tag.MarshalText()
+
+	switch tag {
+	case rpc.LatestBlockNumber, rpc.SafeBlockNumber, rpc.FinalizedBlockNumber:
+		if n, ok := r.list.height(tag); ok {
+			return n, nil
+		}
+		if r.cfg.ClampToFinalized {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownHeight, name)
+		}
+		if tag == rpc.LatestBlockNumber {
+			return r.blockNumber()
+		}
+
+		nodes, err := r.pick("eth_getBlockByNumber", math.MaxInt)
+		if err != nil {
+			return 0, err
+		}
+
+		res := r.request(nodes, [2]int{0, 1}, fetchHeight(tag), nil)
 		if res.err != nil {
-			close(quit)
-			return nil, fmt.Errorf("%w: %s (%s)", res.err, res.endpoint, "request failed during batch operation")
+			if errors.Is(res.err, ethereum.NotFound) {
+				return 0, fmt.Errorf("%w: %s", ErrUnknownHeight, name)
+			}
+			return 0, res.err
 		}
+		return res.blockNumberResponse(), nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", errInvalidBlockTag, name)
+}
 
-		for k, v := range res.transactionResponse() {
-			result[k] = v
+// clamp limits the end of a range to the finalized block if
+// Config.ClampToFinalized is set.
+func (r *Redgla) clamp(end uint64) (uint64, error) {
+	if !r.cfg.ClampToFinalized {
+		return end, nil
+	}
+
+	finalized, err := r.resolve(rpc.FinalizedBlockNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if end > finalized {
+		return finalized, nil
+	}
+	return end, nil
+}
+
+// CacheStats returns the counters of the cache. It is zero if
+// Config.Cache is nil.
+func (r *Redgla) CacheStats() CacheStats {
+	return r.cache.stats()
+}
+
+// finalized returns the highest block number that is depth blocks below
+// the head, if the head of the chain is known.
+func (r *Redgla) finalized(depth uint64) (uint64, bool) {
+	head, err := r.blockNumber()
+	if err != nil {
+		return 0, false
+	}
+
+	if head < depth {
+		return 0, false
+	}
+
+	final := head - depth
+	if r.cfg.ClampToFinalized {
+		if final, err = r.clamp(final); err != nil {
+			return 0, false
 		}
 	}
 
-	return result, nil
+	return final, true
 }
 
-// ReceiptByTxs requests receipts from given transactions to a node.
-func (r *Redgla) ReceiptByTxs(txs []*types.Transaction) (map[common.Hash]*types.Receipt, error) {
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+// blockNumber returns the head of the chain. Unless the heartbeat knows
+// it, it is requested at most once per HeartbeatInterval.
+func (r *Redgla) blockNumber() (uint64, error) {
+	if n, ok := r.list.height(rpc.LatestBlockNumber); ok {
+		return n, nil
 	}
 
-	clients, err := r.dial([]string{nodes[0]})
+	r.tip.mu.Lock()
+	defer r.tip.mu.Unlock()
+
+	if !r.tip.updated.IsZero() && time.Since(r.tip.updated) < r.cfg.HeartbeatInterval {
+		return r.tip.number, nil
+	}
+
+	nodes, err := r.pick("eth_blockNumber", math.MaxInt)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	res := r.request(nodes, [2]int{0, 1}, fetchBlockNumber, nil)
+	if res.err != nil {
+		return 0, res.err
 	}
 
-	return receiptByTxs(clients[0], txs, r.cfg.RequestTimeout, nil)
+	r.tip.number = res.blockNumberResponse()
+	r.tip.updated = time.Now()
+
+	return r.tip.number, nil
 }
 
-// ReceiptByTxsWithBatch transmits and receives batch requests to
-// healthy nodes among the list of registered nodes.
-func (r *Redgla) ReceiptByTxsWithBatch(txs []*types.Transaction) (map[common.Hash]*types.Receipt, error) {
-	if r.cfg.Threshold >= len(txs) {
-		return r.ReceiptByTxs(txs)
+// collect requests the n items to a node, or splits them over the nodes
+// if batch is set and n exceeds the Threshold. Each result is passed to
+// merge.
+func (r *Redgla) collect(method string, n int, batch bool, fn fetchFn, merge func(res *msg)) error {
+	return r.collectTagged(method, "", n, batch, fn, merge)
+}
+
+// collectTagged is collect on the nodes tagged with tag only. If tag is
+// empty, any node is used.
+func (r *Redgla) collectTagged(method string, tag string, n int, batch bool, fn fetchFn, merge func(res *msg)) error {
+	if r.cfg.Quorum != nil {
+		return r.quorum(method, tag, n, fn, merge)
 	}
 
-	nodes := r.list.liveNodes()
-	if len(nodes) == 0 {
-		return nil, ErrNoAliveNode
+	nodes, err := r.pickTagged(method, tag, math.MaxInt)
+	if err != nil {
+		return err
+	}
+
+	if !batch || r.cfg.Threshold >= n {
+		res := r.request(nodes, [2]int{0, n}, fn, nil)
+		if res.err != nil {
+			return res.err
+		}
+
+		merge(res)
+		return nil
+	}
+
+	return r.scatter(nodes, makeBatchIndex(n, len(nodes)), fn, merge)
+}
+
+// fetchFn requests the items [lo, hi) of a request to a node. See the
+// comment of blockByNumbers for quit.
+type fetchFn func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error)
+
+func (r *Redgla) fetchBlocks(numbers []uint64) fetchFn {
+	return func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		return blockByNumbers(client, numbers[lo:hi], r.cfg.Verify, timeout, quit)
+	}
+}
+
+// fetchHeader requests the header of the block, keyed by its number.
+func fetchHeader(number uint64) fetchFn {
+	return func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, err
+		}
+		if header.Number.Uint64() != number {
+			return nil, fmt.Errorf("%w: header %d returned for %d", ErrInvalidData, header.Number, number)
+		}
+		return map[uint64]*types.Header{number: header}, nil
 	}
+}
+
+func fetchHeight(tag rpc.BlockNumber) fetchFn {
+	return func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 
-	clients, err := r.dial(nodes)
+		header, err := client.HeaderByNumber(ctx, big.NewInt(tag.Int64()))
+		if err != nil {
+			return nil, err
+		}
+		return header.Number.Uint64(), nil
+	}
+}
+
+// heights requests the heights of the node in a single batch. The tags
+// the node doesn't know are missing.
+func (r *Redgla) heights(ctx context.Context, endpoint string) heights {
+	client, err := r.dial(r.endpoint(endpoint))
 	if err != nil {
-		return nil, err
+		return nil
 	}
+	defer client.Close()
 
 	var (
-		resc   = make(chan *msg, len(nodes))
-		result = make(map[common.Hash]*types.Receipt, len(txs))
+		headers = make([]*types.Header, len(trackedTags))
+		batch   = make([]rpc.BatchElem, len(trackedTags))
 	)
 
-	quit := make(chan struct{})
-	indices := makeBatchIndex(len(txs), len(nodes))
-	for i, index := range indices {
-		go func(client *ethclient.Client, endpoint string, txs []*types.Transaction) {
-			r, err := receiptByTxs(client, txs, r.cfg.RequestTimeout, quit)
-			if err != nil {
-				resc <- &msg{endpoint, err, nil}
-				return
-			}
-			resc <- &msg{endpoint, nil, r}
-		}(clients[i], nodes[i], txs[index[0]:index[1]])
+	for i, tag := range trackedTags {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{tag, false},
+			Result: &headers[i],
+		}
+	}
+
+	if err := client.rpc.BatchCallContext(ctx, batch); err != nil {
+		return nil
+	}
+
+	res := make(heights, len(trackedTags))
+	for i, tag := range trackedTags {
+		if batch[i].Error == nil && headers[i] != nil {
+			res[tag] = headers[i].Number.Uint64()
+		}
+	}
+
+	return res
+}
+
+func fetchBlockNumber(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.BlockNumber(ctx)
+}
+
+func (r *Redgla) fetchTransactions(hashes []common.Hash) fetchFn {
+	return func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		return transactionByHashes(client, hashes[lo:hi], timeout, quit)
+	}
+}
+
+func (r *Redgla) fetchReceipts(txs []*types.Transaction) fetchFn {
+	return func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		return receiptByTxs(client, txs[lo:hi], timeout, quit)
+	}
+}
+
+// scatter sends the parts to the nodes in order and passes each result
+// to merge. It fails as soon as any part fails.
+func (r *Redgla) scatter(nodes []EndpointConfig, parts [][2]int, fn fetchFn, merge func(res *msg)) error {
+	type job struct {
+		order []EndpointConfig
+		part  [2]int
+	}
+
+	jobs := make([]job, 0, len(parts))
+	for i, part := range parts {
+		// Rotate the nodes so that each part starts on its own node
+		// and falls back to the others in order.
+		k := i % len(nodes)
+		order := append(append([]EndpointConfig(nil), nodes[k:]...), nodes[:k]...)
+
+		for _, p := range splitPart(part, order[0].BatchSize) {
+			jobs = append(jobs, job{order, p})
+		}
+	}
+
+	var (
+		resc = make(chan *msg, len(jobs))
+		quit = make(chan struct{})
+	)
+
+	for _, j := range jobs {
+		go func(j job) {
+			resc <- r.request(j.order, j.part, fn, quit)
+		}(j)
 	}
 
 	for i := 0; i < cap(resc); i++ {
 		res := <-resc
 		if res.err != nil {
 			close(quit)
-			return nil, fmt.Errorf("%w: %s (%s)", res.err, res.endpoint, "request failed during batch operation")
+			return fmt.Errorf("%w: %s (%s)", res.err, res.endpoint, "request failed during batch operation")
 		}
+		merge(res)
+	}
+
+	return nil
+}
+
+// request sends the part to the first node. If the node refuses it
+// because of its rate limit or quota, or returns inconsistent data, the
+// part is shifted to the next node that is not backing off.
+func (r *Redgla) request(nodes []EndpointConfig, part [2]int, fn fetchFn, quit chan struct{}) *msg {
+	var res *msg
 
-		for k, v := range res.receiptResponse() {
-			result[k] = v
+	for _, node := range nodes {
+		if r.throttle.throttled(node.URL) {
+			continue
+		}
+
+		res = r.requestTo(node, part, fn, quit)
+		if res.err == nil || !(isRateLimited(res.err) || errors.Is(res.err, ErrQuotaExhausted) || errors.Is(res.err, ErrInvalidData)) {
+			return res
 		}
 	}
 
-	return result, nil
+	if res == nil {
+		return &msg{nodes[0].name(), ErrNoAliveNode, nil}
+	}
+	return res
 }
 
-func (r *Redgla) dial(endpoints []string) ([]*ethclient.Client, error) {
-	res := make([]*ethclient.Client, 0, len(endpoints))
+func (r *Redgla) requestTo(node EndpointConfig, part [2]int, fn fetchFn, quit chan struct{}) *msg {
+	client, err := r.dial(node)
+	if err != nil {
+		return &msg{node.name(), redactError(err, node), nil}
+	}
 
-	// All of them are dialed and returned even if they are not used.
-	// It's seems OK because no actual communication with the node.
-	for _, endpoint := range endpoints {
-		client, err := ethclient.Dial(endpoint)
-		if err != nil {
-			return nil, err
+	r.inflight.inc(node.URL)
+	defer r.inflight.dec(node.URL)
+
+	v, err := fn(client, node.RequestTimeout, part[0], part[1], quit)
+	if err == nil && r.cfg.Verify {
+		err = verify(client, node.RequestTimeout, v)
+	}
+	if errors.Is(err, ErrInvalidData) {
+		// The node is left out until it's healthy again.
+		r.throttle.backoff(node.URL, unhealthyPeriod)
+	}
+
+	return &msg{node.name(), redactError(err, node), v}
+}
+
+// pick returns up to n live nodes to call the method on, in the order
+// preferred by the configured Selector. Nodes backing off because of
+// their rate limit, or without quota left for the method are left out.
+// If the method costs differently on the nodes, cheaper ones come first.
+func (r *Redgla) pick(method string, n int) ([]EndpointConfig, error) {
+	return r.pickTagged(method, "", n)
+}
+
+// pickTagged is pick among the nodes tagged with tag only. If tag is
+// empty, any node is picked.
+func (r *Redgla) pickTagged(method string, tag string, n int) ([]EndpointConfig, error) {
+	var (
+		members    = r.list.liveMembers()
+		configs    = make(map[string]EndpointConfig, len(members))
+		candidates = make([]Candidate, 0, len(members))
+		exhausted  bool
+	)
+
+	for _, member := range members {
+		cfg, ok := r.list.config(member.key)
+		if !ok {
+			// Deleted after the last heartbeat.
+			continue
+		}
+
+		if tag != "" && !hasTag(cfg.Tags, tag) {
+			continue
+		}
+
+		if r.throttle.throttled(member.key) {
+			continue
 		}
-		res = append(res, client)
+
+		if !r.quotas.affordable(member.key, method) {
+			exhausted = true
+			continue
+		}
+
+		weight := cfg.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		configs[member.key] = cfg
+		candidates = append(candidates, Candidate{
+			Endpoint: member.key,
+			Latency:  member.spent,
+			InFlight: r.inflight.get(member.key),
+			Weight:   weight,
+			Tags:     cfg.Tags,
+		})
 	}
 
-	return res, nil
+	if len(candidates) == 0 {
+		if exhausted {
+			return nil, ErrQuotaExhausted
+		}
+		if tag != "" {
+			return nil, fmt.Errorf("%w tagged %q", ErrNoAliveNode, tag)
+		}
+		return nil, ErrNoAliveNode
+	}
+
+	selected := r.selector.Select(candidates, n)
+	if len(selected) == 0 {
+		return nil, ErrNoAliveNode
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return r.quotas.cost(selected[i].Endpoint, method) < r.quotas.cost(selected[j].Endpoint, method)
+	})
+
+	nodes := make([]EndpointConfig, 0, len(selected))
+	for _, c := range selected {
+		nodes = append(nodes, configs[c.Endpoint])
+	}
+
+	return nodes, nil
+}
+
+// endpoint returns the configuration of the endpoint.
+func (r *Redgla) endpoint(endpoint string) EndpointConfig {
+	if cfg, ok := r.list.config(endpoint); ok {
+		return cfg
+	}
+	return r.cfg.endpoint(EndpointConfig{URL: endpoint})
+}
+
+// conn is a client of a node. The RPC client sends the requests the
+// ethclient doesn't wrap.
+type conn struct {
+	*ethclient.Client
+	rpc *rpc.Client
+
+	// EndpointConfig.BatchSize of the node.
+	batchSize int
+}
+
+// It's seems OK to dial on every request because no actual
+// communication with the node.
+func (r *Redgla) dial(node EndpointConfig) (*conn, error) {
+	client, err := rpc.DialOptions(context.Background(), node.URL, r.dialOptions(node)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{ethclient.NewClient(client), client, node.BatchSize}, nil
+}
+
+// dialOptions are the options of the node, sending the requests through
+// its rate limit and quota.
+func (r *Redgla) dialOptions(node EndpointConfig) []rpc.ClientOption {
+	return append(node.dialOptions(), rpc.WithHTTPClient(r.httpClient(node)))
+}
+
+// redactError replaces the URLs of the node in the errors with the name
+// of the node, since the URLs may contain secrets.
+func redactError(err error, node EndpointConfig) error {
+	if err == nil {
+		return nil
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = node.name()
+	}
+
+	// Errors of the WebSocket dialer may quote the URL as well.
+	msg := err.Error()
+	for _, endpoint := range []string{node.URL, node.WebSocket} {
+		if endpoint != "" {
+			msg = strings.ReplaceAll(msg, endpoint, node.name())
+		}
+	}
+
+	if msg != err.Error() {
+		return &redactedError{err, msg}
+	}
+	return err
 }
 
+// redactedError is an error whose message is redacted.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
 // quit: A Channel that stops all goroutine execution if any of the
 //       batch requests fail. If the stop logic of the goroutine is
 //       not required, it is nil (i.e. a single request).
 
-func blockByRange(client *ethclient.Client, start uint64, end uint64, timeout time.Duration, quit chan struct{}) (res map[uint64]*types.Block, err error) {
-	res = make(map[uint64]*types.Block, end-start)
+// blockByNumbers checks the hashes of the headers if verify is set.
+func blockByNumbers(client *conn, numbers []uint64, verify bool, timeout time.Duration, quit chan struct{}) (res map[uint64]*types.Block, err error) {
+	res = make(map[uint64]*types.Block, len(numbers))
 
 	if quit == nil {
 		quit = make(chan struct{})
@@ -356,7 +1026,7 @@ func blockByRange(client *ethclient.Client, start uint64, end uint64, timeout ti
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	for ; start <= end; start++ {
+	for _, number := range numbers {
 		select {
 		case _, ok := <-quit:
 			if !ok {
@@ -365,7 +1035,7 @@ func blockByRange(client *ethclient.Client, start uint64, end uint64, timeout ti
 		default:
 		}
 
-		res[start], err = client.BlockByNumber(ctx, big.NewInt(int64(start)))
+		res[number], err = getBlock(ctx, client, "eth_getBlockByNumber", hexutil.EncodeUint64(number), verify)
 		if err != nil {
 			return nil, err
 		}
@@ -374,7 +1044,7 @@ func blockByRange(client *ethclient.Client, start uint64, end uint64, timeout ti
 	return res, nil
 }
 
-func transactionByHashes(client *ethclient.Client, hashes []common.Hash, timeout time.Duration, quit chan struct{}) (res map[common.Hash]*types.Transaction, err error) {
+func transactionByHashes(client *conn, hashes []common.Hash, timeout time.Duration, quit chan struct{}) (res map[common.Hash]*types.Transaction, err error) {
 	res = make(map[common.Hash]*types.Transaction, len(hashes))
 
 	if quit == nil {
@@ -402,7 +1072,7 @@ func transactionByHashes(client *ethclient.Client, hashes []common.Hash, timeout
 	return res, nil
 }
 
-func receiptByTxs(client *ethclient.Client, txs []*types.Transaction, timeout time.Duration, quit chan struct{}) (res map[common.Hash]*types.Receipt, err error) {
+func receiptByTxs(client *conn, txs []*types.Transaction, timeout time.Duration, quit chan struct{}) (res map[common.Hash]*types.Receipt, err error) {
 	res = make(map[common.Hash]*types.Receipt, len(txs))
 
 	if quit == nil {
@@ -453,23 +1123,37 @@ func makeBatchIndex(requests int, clients int) [][2]int {
 	return r
 }
 
-func makeBatchRange(start uint64, end uint64, clients int) [][2]uint64 {
-	r := make([][2]uint64, 0)
-
-	batch := (end-start)/uint64(clients) + 1
+// makeRange returns the numbers from start to end, inclusive.
+func makeRange(start uint64, end uint64) []uint64 {
+	if end < start {
+		return nil
+	}
 
-	for i := 0; i < clients; i++ {
-		next := start + batch
-		if next > end {
-			next = end
+	r := make([]uint64, 0, end-start+1)
+	for n := start; n <= end; n++ {
+		r = append(r, n)
+		if n == math.MaxUint64 {
+			break
 		}
-		m := [2]uint64{start, next}
-		start = next
+	}
 
-		r = append(r, m)
-		if start == end {
-			return r
+	return r
+}
+
+// splitPart splits the items [part[0], part[1]) into parts of at most
+// size items. If size is zero, the part is not split.
+func splitPart(part [2]int, size int) [][2]int {
+	if size == 0 || part[1]-part[0] <= size {
+		return [][2]int{part}
+	}
+
+	r := make([][2]int, 0, (part[1]-part[0])/size+1)
+	for lo := part[0]; lo < part[1]; lo += size {
+		hi := lo + size
+		if hi > part[1] {
+			hi = part[1]
 		}
+		r = append(r, [2]int{lo, hi})
 	}
 
 	return r
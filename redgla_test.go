@@ -6,7 +6,23 @@
 package redgla
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func TestMakeBatchIndex(t *testing.T) {
@@ -38,30 +54,407 @@ func TestMakeBatchIndex(t *testing.T) {
 	}
 }
 
-func TestMakeBatchRange(t *testing.T) {
+func TestMakeRange(t *testing.T) {
 	tests := []struct {
-		start   uint64
-		end     uint64
-		clients int
+		start uint64
+		end   uint64
+		want  int
 	}{
-		{100, 200, 5},
-		{111, 1281, 10},
-		{100, 200, 30},
+		{100, 200, 101},
+		{5, 5, 1},
+		{6, 5, 0},
+		{math.MaxUint64 - 1, math.MaxUint64, 2},
 	}
 
 	for _, test := range tests {
-		indices := makeBatchRange(test.start, test.end, test.clients)
+		got := makeRange(test.start, test.end)
+		if len(got) != test.want {
+			t.Fatalf("TestMakeRange: want %v got %v", test.want, len(got))
+		}
+		if len(got) != 0 && (got[0] != test.start || got[len(got)-1] != test.end) {
+			t.Fatalf("TestMakeRange: want [%d, %d] got [%d, %d]", test.start, test.end, got[0], got[len(got)-1])
+		}
+	}
+}
 
-		totalReq := uint64(0)
-		for _, index := range indices {
-			totalReq += index[1] - index[0]
-			if index[1]-index[0] == 0 {
-				t.Fatalf("foo")
+func TestSplitPart(t *testing.T) {
+	tests := []struct {
+		part [2]int
+		size int
+		want [][2]int
+	}{
+		{[2]int{0, 10}, 0, [][2]int{{0, 10}}},
+		{[2]int{0, 10}, 10, [][2]int{{0, 10}}},
+		{[2]int{3, 10}, 3, [][2]int{{3, 6}, {6, 9}, {9, 10}}},
+	}
+
+	for _, test := range tests {
+		got := splitPart(test.part, test.size)
+		if len(got) != len(test.want) {
+			t.Fatalf("TestSplitPart: want %v got %v", test.want, got)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("TestSplitPart: want %v got %v", test.want, got)
 			}
 		}
+	}
+}
+
+// testBackend serves a fake chain whose blocks are empty.
+type testBackend struct{}
+
+func (testBackend) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(1))
+}
+
+// BlockNumber puts the blocks below 936 past the default finality
+// depth.
+func (testBackend) BlockNumber() hexutil.Uint64 {
+	return 1000
+}
+
+func (testBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	return marshalBlock(testHeader(testNumber(number)))
+}
+
+// GetBalance returns the last byte of the address times the block
+// number.
+func (testBackend) GetBalance(address common.Address, block rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	n, _ := block.Number()
+	return (*hexutil.Big)(testBalance(address, testNumber(n))), nil
+}
+
+func testBalance(address common.Address, number uint64) *big.Int {
+	return new(big.Int).SetUint64(uint64(address[common.AddressLength-1]) * number)
+}
+
+// testNumber resolves the tags of the test chain; the head is 1000, the
+// safe block 968 and the finalized block 936.
+func testNumber(number rpc.BlockNumber) uint64 {
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return 1000
+	case rpc.SafeBlockNumber:
+		return 968
+	case rpc.FinalizedBlockNumber:
+		return 936
+	}
+	return uint64(number)
+}
+
+// testHashes memoizes the hashes of the test chain, which would be
+// computed from the genesis every time otherwise.
+var testHashes sync.Map
+
+func testHeader(number uint64) *types.Header {
+	var parent common.Hash
+	if number != 0 {
+		parent = testHash(number - 1)
+	}
+
+	return &types.Header{
+		ParentHash:  parent,
+		UncleHash:   types.EmptyUncleHash,
+		Root:        types.EmptyRootHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  big.NewInt(0),
+		Number:      new(big.Int).SetUint64(number),
+		GasLimit:    30_000_000,
+		Time:        number * 12,
+	}
+}
+
+func testHash(number uint64) common.Hash {
+	if hash, ok := testHashes.Load(number); ok {
+		return hash.(common.Hash)
+	}
+
+	hash := testHeader(number).Hash()
+	testHashes.Store(number, hash)
+
+	return hash
+}
+
+func marshalBlock(header *types.Header) (map[string]interface{}, error) {
+	b, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var res map[string]interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	res["transactions"] = []interface{}{}
+	res["uncles"] = []interface{}{}
+
+	return res, nil
+}
+
+// newTestNode starts a JSON-RPC server serving the backend. The handler,
+// if not nil, wraps the server.
+func newTestNode(t *testing.T, backend interface{}, wrap func(http.Handler) http.Handler) string {
+	return newTestServer(t, map[string]interface{}{"eth": backend}, wrap)
+}
+
+// newTestServer is newTestNode serving the backends keyed by their
+// namespace.
+func newTestServer(t *testing.T, backends map[string]interface{}, wrap func(http.Handler) http.Handler) string {
+	server := rpc.NewServer()
+	for namespace, backend := range backends {
+		if err := server.RegisterName(namespace, backend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var handler http.Handler = server
+	if wrap != nil {
+		handler = wrap(server)
+	}
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+
+	return ts.URL
+}
+
+// newTestRedgla returns a running Redgla whose heartbeat always
+// succeeds, after the first heartbeat is over.
+func newTestRedgla(t *testing.T, cfg *Config) *Redgla {
+	fn := func(context.Context, string) error {
+		return nil
+	}
+
+	r, err := New(fn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Run()
+	t.Cleanup(r.Stop)
+
+	for i := 0; len(r.list.liveNodes()) != len(cfg.endpoints()); i++ {
+		if i == 100 {
+			t.Fatal("heartbeat is not over")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return r
+}
+
+func TestBlockByRangeWithBatch(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	blocks, err := r.BlockByRangeWithBatch(100, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := uint64(100); n <= 150; n++ {
+		block, ok := blocks[n]
+		if !ok {
+			t.Fatalf("TestBlockByRangeWithBatch: missing block %d", n)
+		}
+		if block.Hash() != testHeader(n).Hash() {
+			t.Fatalf("TestBlockByRangeWithBatch: want %v got %v", testHeader(n).Hash(), block.Hash())
+		}
+	}
+}
+
+func TestEndpointConfigs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, nil)}
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, nil), BatchSize: 3, RequestTimeout: time.Second},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	blocks, err := r.BlockByRangeWithBatch(0, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 31 {
+		t.Fatalf("TestEndpointConfigs: want %v got %v", 31, len(blocks))
+	}
+
+	endpoint := EndpointConfig{URL: newTestNode(t, testBackend{}, nil), RateLimit: &RateLimit{Rate: 10}}
+	if err := r.AddEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddNode(endpoint.URL); err == nil {
+		t.Fatal("TestEndpointConfigs: duplicate endpoint is added")
+	}
+
+	if _, ok := r.throttle.limiters[endpoint.URL]; !ok {
+		t.Fatal("TestEndpointConfigs: rate limit of the added endpoint is not applied")
+	}
+
+	if err := r.DelNode(endpoint.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.list.config(endpoint.URL); ok {
+		t.Fatal("TestEndpointConfigs: deleted endpoint is kept")
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	node := EndpointConfig{URL: "https://mynode.io/v2/secret", WebSocket: "wss://mynode.io/ws/secret", Name: "mynode"}
+
+	base := errors.New("dial wss://mynode.io/ws/secret: bad handshake")
+
+	err := redactError(base, node)
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("TestRedactError: secret is exposed, %v", err)
+	}
+	if !errors.Is(err, base) {
+		t.Fatalf("TestRedactError: want %v got %v", base, err)
+	}
+}
+
+func TestErrorsAreRedacted(t *testing.T) {
+	failing := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	}
+
+	// Closed server, the HTTP client fails with the URL in its error.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 1
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, failing) + "/v2/secret", Name: "failing"},
+		{URL: closed.URL + "/v2/secret"},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	for _, node := range cfg.EndpointConfigs {
+		res := r.request([]EndpointConfig{r.endpoint(node.URL)}, [2]int{0, 1}, r.fetchBlocks([]uint64{0}), nil)
+		if res.err == nil {
+			t.Fatal("TestErrorsAreRedacted: request to a failing node succeeded")
+		}
+		if strings.Contains(res.err.Error(), "secret") || strings.Contains(res.endpoint, "secret") {
+			t.Fatalf("TestErrorsAreRedacted: secret is exposed, %s: %v", res.endpoint, res.err)
+		}
+	}
+
+	_, err := r.BlockByRangeWithBatch(0, 10)
+	if err == nil {
+		t.Fatal("TestErrorsAreRedacted: batch request to failing nodes succeeded")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("TestErrorsAreRedacted: secret is exposed, %v", err)
+	}
+
+	if err := r.DelNode("failing"); err != nil {
+		t.Fatal(err)
+	}
+}
 
-		if totalReq != test.end-test.start {
-			t.Fatalf("invalid makeBatchRange, want: %d got: %d", test.end-test.start, totalReq)
+func TestBlockByRangeTo(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, nil)}
+
+	r := newTestRedgla(t, cfg)
+
+	tests := []struct {
+		end  rpc.BlockNumber
+		want int
+	}{
+		{rpc.BlockNumber(930), 1},
+		{rpc.FinalizedBlockNumber, 7},
+		{rpc.SafeBlockNumber, 39},
+		{rpc.LatestBlockNumber, 71},
+	}
+
+	for _, test := range tests {
+		blocks, err := r.BlockByRangeTo(930, test.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocks) != test.want {
+			t.Fatalf("TestBlockByRangeTo: want %v got %v", test.want, len(blocks))
 		}
 	}
+
+	if _, err := r.BlockByRangeTo(930, rpc.PendingBlockNumber); !errors.Is(err, errInvalidBlockTag) {
+		t.Fatalf("TestBlockByRangeTo: want %v got %v", errInvalidBlockTag, err)
+	}
+}
+
+func TestHeightsTracked(t *testing.T) {
+	var calls int64
+
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, countMethod("eth_getBlockByNumber", &calls))}
+
+	r := newTestRedgla(t, cfg)
+
+	// The heartbeats request the heights without the clamp too.
+	if n, ok := r.list.height(rpc.SafeBlockNumber); !ok || n != 968 {
+		t.Fatalf("TestHeightsTracked: want %v got %v", 968, n)
+	}
+
+	// The end is resolved without another request.
+	atomic.StoreInt64(&calls, 0)
+
+	blocks, err := r.BlockByRangeTo(960, rpc.SafeBlockNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 9 {
+		t.Fatalf("TestHeightsTracked: want %v got %v", 9, len(blocks))
+	}
+	if got := atomic.LoadInt64(&calls); got != 9 {
+		t.Fatalf("TestHeightsTracked: want %v got %v", 9, got)
+	}
+}
+
+func TestClampToFinalized(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ClampToFinalized = true
+	cfg.Cache = &CacheConfig{MaxEntries: 100, FinalityDepth: 1}
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, nil)}
+
+	r := newTestRedgla(t, cfg)
+
+	if n, ok := r.list.height(rpc.FinalizedBlockNumber); !ok || n != 936 {
+		t.Fatalf("TestClampToFinalized: want %v got %v", 936, n)
+	}
+
+	blocks, err := r.BlockByRangeWithBatch(930, 999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 7 {
+		t.Fatalf("TestClampToFinalized: want %v got %v", 7, len(blocks))
+	}
+
+	// Only the finalized blocks are cached, despite the finality depth.
+	if _, err := r.BlockByRangeTo(930, rpc.BlockNumber(940)); err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.CacheStats(); stats.Entries != 7 {
+		t.Fatalf("TestClampToFinalized: want %v got %v", 7, stats.Entries)
+	}
 }
@@ -0,0 +1,180 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Number of times the broken links of a range are repaired before
+// giving up. The chain may keep reorging while it is being repaired.
+const maxReorgRepairs = 3
+
+// ReorgDetected is returned by the range requests if Config.CheckParentHash
+// is set and the blocks can't be assembled into a single chain, e.g. the
+// nodes disagree on the block without a majority.
+type ReorgDetected struct {
+	// Number of the block that isn't the child of the previous block.
+	Number uint64
+}
+
+func (e *ReorgDetected) Error() string {
+	return fmt.Sprintf("reorg detected at block %d", e.Number)
+}
+
+// brokenLinks returns the numbers of the blocks whose parent is not the
+// previous block, in ascending order. Blocks without a previous block in
+// the map are not checked.
+func brokenLinks(blocks map[uint64]*types.Block) []uint64 {
+	var res []uint64
+	for n, block := range blocks {
+		if n == 0 {
+			continue
+		}
+		if parent, ok := blocks[n-1]; ok && block.ParentHash() != chainHash(parent) {
+			res = append(res, n)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// verifyChain repairs the blocks stitched from different nodes until
+// they form a single chain. The blocks around a broken link that differ
+// from the majority of the nodes are replaced by the blocks of a node of
+// the majority.
+func (r *Redgla) verifyChain(blocks map[uint64]*types.Block) error {
+	for i := 0; ; i++ {
+		broken := brokenLinks(blocks)
+		if len(broken) == 0 {
+			return nil
+		}
+
+		if i == maxReorgRepairs {
+			return &ReorgDetected{broken[0]}
+		}
+
+		for _, n := range broken {
+			if err := r.repair(blocks, n); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// repair replaces the blocks around the broken link at n with the
+// blocks of a majority node, as long as they differ from them.
+func (r *Redgla) repair(blocks map[uint64]*types.Block, n uint64) error {
+	node, majority, err := r.majority(n)
+	if err != nil {
+		return err
+	}
+
+	fetch := func(number uint64) (*types.Block, error) {
+		res := r.requestTo(node, [2]int{0, 1}, r.fetchBlocks([]uint64{number}), nil)
+		if res.err != nil {
+			return nil, res.err
+		}
+		return res.blockResponse()[number], nil
+	}
+
+	// The majority block is already known, walk up from it first.
+	replace := majority
+	for k := n; ; k++ {
+		block, ok := blocks[k]
+		if !ok || chainHash(block) == chainHash(replace) {
+			break
+		}
+		blocks[k] = replace
+
+		if k == math.MaxUint64 {
+			break
+		}
+		if _, ok := blocks[k+1]; !ok {
+			break
+		}
+		if replace, err = fetch(k + 1); err != nil {
+			return err
+		}
+	}
+
+	// Then down from the parent of the majority block.
+	for k := n - 1; ; k-- {
+		block, ok := blocks[k]
+		if !ok {
+			break
+		}
+
+		replace, err := fetch(k)
+		if err != nil {
+			return err
+		}
+		if chainHash(block) == chainHash(replace) {
+			break
+		}
+		blocks[k] = replace
+
+		if k == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// majority asks the live nodes for the block n and returns a node that
+// agrees with more than half of the responses, along with its block.
+func (r *Redgla) majority(n uint64) (EndpointConfig, *types.Block, error) {
+	nodes, err := r.pick("eth_getBlockByNumber", math.MaxInt)
+	if err != nil {
+		return EndpointConfig{}, nil, err
+	}
+
+	var (
+		res = make([]*msg, len(nodes))
+		wg  sync.WaitGroup
+	)
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node EndpointConfig) {
+			defer wg.Done()
+			res[i] = r.requestTo(node, [2]int{0, 1}, r.fetchBlocks([]uint64{n}), nil)
+		}(i, node)
+	}
+	wg.Wait()
+
+	var (
+		votes = make(map[common.Hash]int)
+		total int
+	)
+
+	for _, m := range res {
+		if m.err == nil {
+			votes[chainHash(m.blockResponse()[n])]++
+			total++
+		}
+	}
+
+	// Prefer the nodes in the order of the Selector.
+	for i, m := range res {
+		if m.err != nil {
+			continue
+		}
+		if block := m.blockResponse()[n]; votes[chainHash(block)]*2 > total {
+			return nodes[i], block, nil
+		}
+	}
+
+	return EndpointConfig{}, nil, &ReorgDetected{n}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testForkBackend serves the chain of testBackend, forked from the block
+// 'from'.
+type testForkBackend struct {
+	testBackend
+	from uint64
+}
+
+func (b testForkBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	return marshalBlock(testForkHeader(testNumber(number), b.from))
+}
+
+func testForkHeader(number uint64, from uint64) *types.Header {
+	if number < from {
+		return testHeader(number)
+	}
+
+	header := testHeader(number)
+	header.ParentHash = testForkHash(number-1, from)
+	header.Extra = []byte("fork")
+
+	return header
+}
+
+var testForkHashes sync.Map
+
+func testForkHash(number uint64, from uint64) common.Hash {
+	key := [2]uint64{number, from}
+	if hash, ok := testForkHashes.Load(key); ok {
+		return hash.(common.Hash)
+	}
+
+	hash := testForkHeader(number, from).Hash()
+	testForkHashes.Store(key, hash)
+
+	return hash
+}
+
+func TestBrokenLinks(t *testing.T) {
+	blocks := make(map[uint64]*types.Block)
+	for n := uint64(10); n < 20; n++ {
+		blocks[n] = types.NewBlockWithHeader(testHeader(n))
+	}
+
+	if broken := brokenLinks(blocks); len(broken) != 0 {
+		t.Fatalf("TestBrokenLinks: want %v got %v", 0, len(broken))
+	}
+
+	blocks[15] = types.NewBlockWithHeader(testForkHeader(15, 15))
+	if broken := brokenLinks(blocks); len(broken) != 1 || broken[0] != 16 {
+		t.Fatalf("TestBrokenLinks: want %v got %v", []uint64{16}, broken)
+	}
+}
+
+func TestCheckParentHash(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.CheckParentHash = true
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testForkBackend{from: 120}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Whichever part the forked node serves, the range is repaired.
+	for i := 0; i < 5; i++ {
+		blocks, err := r.BlockByRangeWithBatch(100, 150)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := uint64(100); n <= 150; n++ {
+			if blocks[n].Hash() != testHeader(n).Hash() {
+				t.Fatalf("TestCheckParentHash: block %d: want %v got %v", n, testHeader(n).Hash(), blocks[n].Hash())
+			}
+		}
+	}
+}
+
+func TestCheckParentHashCache(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.CheckParentHash = true
+	cfg.Cache = &CacheConfig{MaxEntries: 100, FinalityDepth: 1}
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testForkBackend{from: 120}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	// Only the repaired blocks are cached, whichever part the forked
+	// node serves.
+	for i := 0; i < 5; i++ {
+		r := newTestRedgla(t, cfg)
+
+		if _, err := r.BlockByRangeWithBatch(100, 150); err != nil {
+			t.Fatal(err)
+		}
+
+		cached := make(map[uint64]*types.Block)
+		r.cache.blocks(makeRange(100, 150), cached)
+
+		for n, block := range cached {
+			if block.Hash() != testHeader(n).Hash() {
+				t.Fatalf("TestCheckParentHashCache: block %d: want %v got %v", n, testHeader(n).Hash(), block.Hash())
+			}
+		}
+		if len(cached) != 51 {
+			t.Fatalf("TestCheckParentHashCache: want %v got %v", 51, len(cached))
+		}
+	}
+}
+
+func TestReorgDetected(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.CheckParentHash = true
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testForkBackend{from: 120}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Without a majority, the range can't be assembled.
+	for i := 0; i < 5; i++ {
+		_, err := r.BlockByRangeWithBatch(100, 150)
+
+		var reorg *ReorgDetected
+		if !errors.As(err, &reorg) {
+			t.Fatalf("TestReorgDetected: want %T got %v", reorg, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Candidate is a live node offered to a Selector, along with the
+// information the built-in strategies rank it by.
+type Candidate struct {
+	Endpoint string
+
+	// Response time of the last heartbeat.
+	Latency time.Duration
+
+	// Number of requests redgla is currently running against the node.
+	InFlight int64
+
+	// EndpointConfig.Weight, at least 1.
+	Weight int
+
+	// EndpointConfig.Tags.
+	Tags []string
+}
+
+// Selector decides which live nodes a request is sent to. Single
+// requests use the first returned candidate, batch requests split
+// their work over the returned candidates in order.
+type Selector interface {
+	// Select returns up to n distinct candidates ordered by preference.
+	// The given slice may be reordered by the implementation.
+	Select(candidates []Candidate, n int) []Candidate
+}
+
+// NewFastestFirstSelector returns a Selector that prefers the nodes
+// with the fastest heartbeat response time. This is the default.
+func NewFastestFirstSelector() Selector {
+	return fastestFirst{}
+}
+
+type fastestFirst struct{}
+
+func (fastestFirst) Select(candidates []Candidate, n int) []Candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Latency < candidates[j].Latency
+	})
+	return head(candidates, n)
+}
+
+// NewRoundRobinSelector returns a Selector that rotates the preferred
+// node on every selection.
+func NewRoundRobinSelector() Selector {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (r *roundRobin) Select(candidates []Candidate, n int) []Candidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// The live node list isn't ordered, so we sort it to keep the
+	// rotation stable between heartbeats.
+	sortByEndpoint(candidates)
+
+	var (
+		start = int((atomic.AddUint64(&r.next, 1) - 1) % uint64(len(candidates)))
+		res   = make([]Candidate, 0, len(candidates))
+	)
+
+	res = append(res, candidates[start:]...)
+	res = append(res, candidates[:start]...)
+
+	return head(res, n)
+}
+
+// NewWeightedRandomSelector returns a Selector that picks nodes at
+// random, in proportion to the given weights. Endpoints missing from
+// the map have the weight of their EndpointConfig, and a weight of zero
+// or less excludes the endpoint unless no other node is available.
+func NewWeightedRandomSelector(weights map[string]int) Selector {
+	return &weightedRandom{
+		weights: weights,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+type weightedRandom struct {
+	weights map[string]int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (w *weightedRandom) weight(c Candidate) int {
+	if weight, ok := w.weights[c.Endpoint]; ok {
+		if weight < 0 {
+			return 0
+		}
+		return weight
+	}
+
+	if c.Weight < 1 {
+		return 1
+	}
+	return c.Weight
+}
+
+func (w *weightedRandom) Select(candidates []Candidate, n int) []Candidate {
+	sortByEndpoint(candidates)
+
+	var (
+		rest = append([]Candidate(nil), candidates...)
+		res  = make([]Candidate, 0, len(candidates))
+	)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(rest) != 0 && len(res) < n {
+		total := 0
+		for _, c := range rest {
+			total += w.weight(c)
+		}
+
+		// Only zero-weighted nodes are left. They are used, in order,
+		// only if no other node was picked.
+		if total == 0 {
+			if len(res) == 0 {
+				res = append(res, rest...)
+			}
+			break
+		}
+
+		pick := w.rand.Intn(total)
+		for i, c := range rest {
+			if pick -= w.weight(c); pick < 0 {
+				res = append(res, c)
+				rest = append(rest[:i], rest[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return head(res, n)
+}
+
+// NewLeastInFlightSelector returns a Selector that prefers the nodes
+// with the fewest running requests. Ties are broken by response time.
+func NewLeastInFlightSelector() Selector {
+	return leastInFlight{}
+}
+
+type leastInFlight struct{}
+
+func (leastInFlight) Select(candidates []Candidate, n int) []Candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return lessLoaded(candidates[i], candidates[j])
+	})
+	return head(candidates, n)
+}
+
+// NewPowerOfTwoSelector returns a Selector that samples two random
+// nodes and prefers the less loaded one. It spreads the load almost as
+// well as NewLeastInFlightSelector without herding every request to the
+// same node.
+func NewPowerOfTwoSelector() Selector {
+	return &powerOfTwo{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+type powerOfTwo struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (p *powerOfTwo) Select(candidates []Candidate, n int) []Candidate {
+	var (
+		rest = append([]Candidate(nil), candidates...)
+		res  = make([]Candidate, 0, len(candidates))
+	)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(rest) != 0 && len(res) < n {
+		i := p.rand.Intn(len(rest))
+		if len(rest) > 1 {
+			j := p.rand.Intn(len(rest) - 1)
+			if j >= i {
+				j++
+			}
+			if lessLoaded(rest[j], rest[i]) {
+				i = j
+			}
+		}
+
+		res = append(res, rest[i])
+		rest = append(rest[:i], rest[i+1:]...)
+	}
+
+	return res
+}
+
+func lessLoaded(a, b Candidate) bool {
+	if a.InFlight != b.InFlight {
+		return a.InFlight < b.InFlight
+	}
+	return a.Latency < b.Latency
+}
+
+func sortByEndpoint(candidates []Candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Endpoint < candidates[j].Endpoint
+	})
+}
+
+func head(candidates []Candidate, n int) []Candidate {
+	if n < len(candidates) {
+		return candidates[:n]
+	}
+	return candidates
+}
+
+// inflight counts the requests running against each endpoint.
+type inflight struct {
+	mu sync.Mutex
+	m  map[string]int64
+}
+
+func newInflight() *inflight {
+	return &inflight{m: make(map[string]int64)}
+}
+
+func (f *inflight) inc(endpoint string) {
+	f.mu.Lock()
+	f.m[endpoint]++
+	f.mu.Unlock()
+}
+
+func (f *inflight) dec(endpoint string) {
+	f.mu.Lock()
+	if f.m[endpoint]--; f.m[endpoint] <= 0 {
+		delete(f.m, endpoint)
+	}
+	f.mu.Unlock()
+}
+
+func (f *inflight) get(endpoint string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.m[endpoint]
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"testing"
+	"time"
+)
+
+func testCandidates() []Candidate {
+	return []Candidate{
+		{Endpoint: "http://127.0.0.1:1001", Latency: 30 * time.Millisecond, InFlight: 0},
+		{Endpoint: "http://127.0.0.1:1002", Latency: 10 * time.Millisecond, InFlight: 5},
+		{Endpoint: "http://127.0.0.1:1003", Latency: 20 * time.Millisecond, InFlight: 1},
+	}
+}
+
+func TestFastestFirstSelector(t *testing.T) {
+	res := NewFastestFirstSelector().Select(testCandidates(), 3)
+
+	want := []string{"http://127.0.0.1:1002", "http://127.0.0.1:1003", "http://127.0.0.1:1001"}
+	for i, c := range res {
+		if c.Endpoint != want[i] {
+			t.Fatalf("TestFastestFirstSelector: want %v got %v", want[i], c.Endpoint)
+		}
+	}
+
+	if res := NewFastestFirstSelector().Select(testCandidates(), 1); len(res) != 1 {
+		t.Fatalf("TestFastestFirstSelector: want %v got %v", 1, len(res))
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	s := NewRoundRobinSelector()
+
+	want := []string{"http://127.0.0.1:1001", "http://127.0.0.1:1002", "http://127.0.0.1:1003", "http://127.0.0.1:1001"}
+	for _, expect := range want {
+		res := s.Select(testCandidates(), 1)
+		if res[0].Endpoint != expect {
+			t.Fatalf("TestRoundRobinSelector: want %v got %v", expect, res[0].Endpoint)
+		}
+	}
+}
+
+func TestWeightedRandomSelector(t *testing.T) {
+	s := NewWeightedRandomSelector(map[string]int{
+		"http://127.0.0.1:1001": 0,
+		"http://127.0.0.1:1002": 0,
+	})
+
+	for i := 0; i < 100; i++ {
+		res := s.Select(testCandidates(), 3)
+		if len(res) != 1 {
+			t.Fatalf("TestWeightedRandomSelector: want %v got %v", 1, len(res))
+		}
+		if res[0].Endpoint != "http://127.0.0.1:1003" {
+			t.Fatalf("TestWeightedRandomSelector: want %v got %v", "http://127.0.0.1:1003", res[0].Endpoint)
+		}
+	}
+
+	// With no other node, the zero-weighted nodes are used.
+	s = NewWeightedRandomSelector(map[string]int{
+		"http://127.0.0.1:1001": 0,
+		"http://127.0.0.1:1002": 0,
+		"http://127.0.0.1:1003": 0,
+	})
+	if res := s.Select(testCandidates(), 3); len(res) != 3 {
+		t.Fatalf("TestWeightedRandomSelector: want %v got %v", 3, len(res))
+	}
+}
+
+func TestWeightedRandomSelectorWithEndpointWeight(t *testing.T) {
+	s := NewWeightedRandomSelector(nil)
+
+	candidates := testCandidates()
+	candidates[0].Weight = 1000
+	candidates[1].Weight = 1
+	candidates[2].Weight = 1
+
+	picked := 0
+	for i := 0; i < 100; i++ {
+		res := s.Select(append([]Candidate(nil), candidates...), 1)
+		if res[0].Endpoint == "http://127.0.0.1:1001" {
+			picked++
+		}
+	}
+
+	if picked < 90 {
+		t.Fatalf("TestWeightedRandomSelectorWithEndpointWeight: the heaviest node is picked %d/100 times", picked)
+	}
+}
+
+func TestLeastInFlightSelector(t *testing.T) {
+	res := NewLeastInFlightSelector().Select(testCandidates(), 3)
+
+	want := []string{"http://127.0.0.1:1001", "http://127.0.0.1:1003", "http://127.0.0.1:1002"}
+	for i, c := range res {
+		if c.Endpoint != want[i] {
+			t.Fatalf("TestLeastInFlightSelector: want %v got %v", want[i], c.Endpoint)
+		}
+	}
+}
+
+func TestPowerOfTwoSelector(t *testing.T) {
+	s := NewPowerOfTwoSelector()
+
+	for i := 0; i < 100; i++ {
+		res := s.Select(testCandidates(), 1)
+		// The most loaded node never wins a two-way comparison.
+		if res[0].Endpoint == "http://127.0.0.1:1002" {
+			t.Fatalf("TestPowerOfTwoSelector: the most loaded node is selected")
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range s.Select(testCandidates(), 3) {
+		seen[c.Endpoint] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("TestPowerOfTwoSelector: want %v got %v", 3, len(seen))
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Number of recent blocks whose state is kept by the nodes that aren't
+// archive nodes. It is the default of geth.
+const archiveDepth = 128
+
+var errNilBlock = errors.New("block number must not be nil")
+
+// accountQuery is the state of an address at a block. A nil block is
+// the latest block.
+type accountQuery struct {
+	address common.Address
+	block   *big.Int
+}
+
+// StorageSlot is a storage slot of a contract.
+type StorageSlot struct {
+	Address common.Address
+	Slot    common.Hash
+}
+
+// BalancesAt requests the balances of the addresses at the block. If
+// block is nil, it is the latest block. Requests of more addresses than
+// the Threshold are split over the live nodes.
+func (r *Redgla) BalancesAt(addresses []common.Address, block *big.Int) (map[common.Address]*big.Int, error) {
+	addresses = uniqueAddresses(addresses)
+
+	queries := make([]accountQuery, len(addresses))
+	for i, address := range addresses {
+		queries[i] = accountQuery{address, block}
+	}
+
+	balances, err := r.balancesAt(queries)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[common.Address]*big.Int, len(addresses))
+	for i, balance := range balances {
+		result[queries[i].address] = balance
+	}
+
+	return result, nil
+}
+
+// BalancesAtBlocks is BalancesAt for several blocks. The result is keyed
+// by the block number.
+func (r *Redgla) BalancesAtBlocks(addresses []common.Address, blocks []*big.Int) (map[uint64]map[common.Address]*big.Int, error) {
+	addresses = uniqueAddresses(addresses)
+
+	queries := make([]accountQuery, 0, len(addresses)*len(blocks))
+	for _, block := range blocks {
+		if block == nil {
+			return nil, errNilBlock
+		}
+		for _, address := range addresses {
+			queries = append(queries, accountQuery{address, block})
+		}
+	}
+
+	balances, err := r.balancesAt(queries)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint64]map[common.Address]*big.Int, len(blocks))
+	for i, balance := range balances {
+		n := queries[i].block.Uint64()
+		if result[n] == nil {
+			result[n] = make(map[common.Address]*big.Int, len(addresses))
+		}
+		result[n][queries[i].address] = balance
+	}
+
+	return result, nil
+}
+
+// balancesAt requests the balances of the queries, keyed by their index.
+// Concurrent callers share the requests of the balances at fixed blocks.
+func (r *Redgla) balancesAt(queries []accountQuery) (map[int]*big.Int, error) {
+	var (
+		keys   = make([]cacheKey, 0, len(queries))
+		fixed  = make([]int, 0, len(queries))
+		others = make([]int, 0, len(queries))
+		rest   = make([]accountQuery, 0, len(queries))
+	)
+
+	for i, query := range queries {
+		if !fixedBlock(query.block) {
+			others = append(others, i)
+			rest = append(rest, query)
+			continue
+		}
+		keys = append(keys, cacheKey{kind: kindBalance, number: query.block.Uint64(), address: query.address})
+		fixed = append(fixed, i)
+	}
+
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		pending := make([]accountQuery, 0, len(own))
+		for _, i := range own {
+			pending = append(pending, queries[fixed[i]])
+		}
+
+		balances, err := r.fetchBalances(pending)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make(map[cacheKey]interface{}, len(balances))
+		for k, v := range balances {
+			res[cacheKey{kind: kindBalance, number: pending[k].block.Uint64(), address: pending[k].address}] = v
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := r.fetchBalances(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]*big.Int, len(queries))
+	for i, key := range keys {
+		if v, ok := fetched[key]; ok {
+			result[fixed[i]] = v.(*big.Int)
+		}
+	}
+	for k, v := range balances {
+		result[others[k]] = v
+	}
+
+	return result, nil
+}
+
+func (r *Redgla) fetchBalances(queries []accountQuery) (map[int]*big.Int, error) {
+	result := make(map[int]*big.Int, len(queries))
+	if len(queries) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[int]*big.Int, hi-lo)
+		err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) (err error) {
+			res[i], err = client.BalanceAt(ctx, queries[i].address, queries[i].block)
+			return err
+		})
+		return res, err
+	}
+
+	blocks := make([]*big.Int, len(queries))
+	for i, query := range queries {
+		blocks[i] = query.block
+	}
+
+	err := r.collectTagged("eth_getBalance", r.stateTag(blocks...), len(queries), true, fn, func(m *msg) {
+		for k, v := range m.bigResponse() {
+			result[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NoncesAt requests the nonces of the addresses at the block. If block
+// is nil, it is the latest block. Requests of more addresses than the
+// Threshold are split over the live nodes.
+func (r *Redgla) NoncesAt(addresses []common.Address, block *big.Int) (map[common.Address]uint64, error) {
+	addresses = uniqueAddresses(addresses)
+
+	if !fixedBlock(block) {
+		return r.noncesAt(addresses, block)
+	}
+
+	keys := make([]cacheKey, len(addresses))
+	for i, address := range addresses {
+		keys[i] = cacheKey{kind: kindNonce, number: block.Uint64(), address: address}
+	}
+
+	// Concurrent callers share the request of each nonce.
+	fetched, err := r.flights.do(keys, func(own []int) (map[cacheKey]interface{}, error) {
+		pending := make([]common.Address, 0, len(own))
+		for _, i := range own {
+			pending = append(pending, addresses[i])
+		}
+
+		nonces, err := r.noncesAt(pending, block)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make(map[cacheKey]interface{}, len(nonces))
+		for k, v := range nonces {
+			res[cacheKey{kind: kindNonce, number: block.Uint64(), address: k}] = v
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[common.Address]uint64, len(fetched))
+	for k, v := range fetched {
+		result[k.address] = v.(uint64)
+	}
+
+	return result, nil
+}
+
+func (r *Redgla) noncesAt(addresses []common.Address, block *big.Int) (map[common.Address]uint64, error) {
+	result := make(map[common.Address]uint64, len(addresses))
+	if len(addresses) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[int]uint64, hi-lo)
+		err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) (err error) {
+			res[i], err = client.NonceAt(ctx, addresses[i], block)
+			return err
+		})
+		return res, err
+	}
+
+	err := r.collectTagged("eth_getTransactionCount", r.stateTag(block), len(addresses), true, fn, func(m *msg) {
+		for k, v := range m.nonceResponse() {
+			result[addresses[k]] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// StorageAtMany requests the values of the storage slots at the block.
+// If block is nil, it is the latest block. Requests of more slots than
+// the Threshold are split over the live nodes.
+func (r *Redgla) StorageAtMany(slots []StorageSlot, block *big.Int) (map[StorageSlot]common.Hash, error) {
+	var (
+		seen   = make(map[StorageSlot]bool, len(slots))
+		unique = make([]StorageSlot, 0, len(slots))
+	)
+
+	for _, slot := range slots {
+		if !seen[slot] {
+			seen[slot] = true
+			unique = append(unique, slot)
+		}
+	}
+
+	result := make(map[StorageSlot]common.Hash, len(unique))
+	if len(unique) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[int]common.Hash, hi-lo)
+		err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) error {
+			value, err := client.StorageAt(ctx, unique[i].Address, unique[i].Slot, block)
+			if err != nil {
+				return err
+			}
+			res[i] = common.BytesToHash(value)
+			return nil
+		})
+		return res, err
+	}
+
+	err := r.collectTagged("eth_getStorageAt", r.stateTag(block), len(unique), true, fn, func(m *msg) {
+		for k, v := range m.hashResponse() {
+			result[unique[k]] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CodeAtMany requests the code of the addresses at the block. If block
+// is nil, it is the latest block. Requests of more addresses than the
+// Threshold are split over the live nodes.
+func (r *Redgla) CodeAtMany(addresses []common.Address, block *big.Int) (map[common.Address][]byte, error) {
+	addresses = uniqueAddresses(addresses)
+
+	result := make(map[common.Address][]byte, len(addresses))
+	if len(addresses) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, timeout time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[int][]byte, hi-lo)
+		err := forEach(context.Background(), lo, hi, timeout, quit, func(ctx context.Context, i int) (err error) {
+			res[i], err = client.CodeAt(ctx, addresses[i], block)
+			return err
+		})
+		return res, err
+	}
+
+	err := r.collectTagged("eth_getCode", r.stateTag(block), len(addresses), true, fn, func(m *msg) {
+		for k, v := range m.bytesResponse() {
+			result[addresses[k]] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// fixedBlock reports whether the block is a number rather than a tag,
+// so that the state at it doesn't change.
+func fixedBlock(block *big.Int) bool {
+	return block != nil && block.Sign() >= 0 && block.IsUint64()
+}
+
+// stateTag returns TagArchive if the state of any of the blocks may be
+// pruned by the nodes that aren't archive nodes, and some endpoint is
+// tagged with it. A nil block is the latest block. If the head is
+// unknown, the blocks are assumed to be old.
+func (r *Redgla) stateTag(blocks ...*big.Int) string {
+	archive := false
+	for _, node := range r.list.nodes() {
+		if hasTag(node.Tags, TagArchive) {
+			archive = true
+			break
+		}
+	}
+	if !archive {
+		return ""
+	}
+
+	var (
+		head  uint64
+		known bool
+	)
+
+	for _, block := range blocks {
+		if block == nil || !block.IsUint64() {
+			continue
+		}
+
+		if !known {
+			n, err := r.blockNumber()
+			if err != nil {
+				return TagArchive
+			}
+			head, known = n, true
+		}
+
+		if head > archiveDepth && block.Uint64() < head-archiveDepth {
+			return TagArchive
+		}
+	}
+
+	return ""
+}
+
+// forEach calls fn for the items [lo, hi) in order until it fails. See
+// the comment of blockByNumbers for quit.
+func forEach(ctx context.Context, lo int, hi int, timeout time.Duration, quit chan struct{}, fn func(ctx context.Context, i int) error) error {
+	if quit == nil {
+		quit = make(chan struct{})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for i := lo; i < hi; i++ {
+		select {
+		case _, ok := <-quit:
+			if !ok {
+				return ErrBatchFailure
+			}
+		default:
+		}
+
+		if err := fn(ctx, i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueAddresses returns the addresses without the repeated ones, in
+// the order of their first appearance.
+func uniqueAddresses(addresses []common.Address) []common.Address {
+	var (
+		seen = make(map[common.Address]bool, len(addresses))
+		res  = make([]common.Address, 0, len(addresses))
+	)
+
+	for _, address := range addresses {
+		if !seen[address] {
+			seen[address] = true
+			res = append(res, address)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// GetStorageAt returns the hash of the address, the slot and the block
+// number.
+func (testBackend) GetStorageAt(address common.Address, slot string, block rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	n, _ := block.Number()
+	return testStorage(address, common.HexToHash(slot), testNumber(n)).Bytes(), nil
+}
+
+func testStorage(address common.Address, slot common.Hash, number uint64) common.Hash {
+	return crypto.Keccak256Hash(address.Bytes(), slot.Bytes(), new(big.Int).SetUint64(number).Bytes())
+}
+
+// GetTransactionCount returns the last byte of the address plus the
+// block number.
+func (testBackend) GetTransactionCount(address common.Address, block rpc.BlockNumberOrHash) hexutil.Uint64 {
+	n, _ := block.Number()
+	return hexutil.Uint64(uint64(address[common.AddressLength-1]) + testNumber(n))
+}
+
+// GetCode returns the address as the code.
+func (testBackend) GetCode(address common.Address, block rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	return address.Bytes(), nil
+}
+
+// countMethod counts the calls of the method, including those of batch
+// requests, in calls.
+func countMethod(method string, calls *int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			atomic.AddInt64(calls, int64(strings.Count(string(body), `"`+method+`"`)))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func testAddresses(n int) []common.Address {
+	res := make([]common.Address, n)
+	for i := range res {
+		res[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	return res
+}
+
+func TestUniqueAddresses(t *testing.T) {
+	addresses := testAddresses(3)
+
+	res := uniqueAddresses(append(addresses, addresses[1], addresses[0]))
+	if len(res) != 3 {
+		t.Fatalf("TestUniqueAddresses: want %v got %v", 3, len(res))
+	}
+	for i := range res {
+		if res[i] != addresses[i] {
+			t.Fatalf("TestUniqueAddresses: want %v got %v", addresses[i], res[i])
+		}
+	}
+}
+
+func TestBalancesAt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	addresses := testAddresses(20)
+
+	balances, err := r.BalancesAt(append(addresses, addresses[0]), big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != len(addresses) {
+		t.Fatalf("TestBalancesAt: want %v got %v", len(addresses), len(balances))
+	}
+	for _, address := range addresses {
+		if want := testBalance(address, 10); balances[address].Cmp(want) != 0 {
+			t.Fatalf("TestBalancesAt: want %v got %v", want, balances[address])
+		}
+	}
+
+	// The latest block.
+	balances, err = r.BalancesAt(addresses[:1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testBalance(addresses[0], 1000); balances[addresses[0]].Cmp(want) != 0 {
+		t.Fatalf("TestBalancesAt: want %v got %v", want, balances[addresses[0]])
+	}
+
+	res, err := r.BalancesAtBlocks(addresses, []*big.Int{big.NewInt(1), big.NewInt(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []uint64{1, 2} {
+		for _, address := range addresses {
+			if want := testBalance(address, n); res[n][address].Cmp(want) != 0 {
+				t.Fatalf("TestBalancesAt: want %v got %v", want, res[n][address])
+			}
+		}
+	}
+}
+
+func TestStorageAtMany(t *testing.T) {
+	var archive, full int64
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestNode(t, testBackend{}, countMethod("eth_getStorageAt", &archive)), Tags: []string{TagArchive}},
+		{URL: newTestNode(t, testBackend{}, countMethod("eth_getStorageAt", &full))},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	var slots []StorageSlot
+	for _, address := range testAddresses(4) {
+		for i := int64(0); i < 5; i++ {
+			slots = append(slots, StorageSlot{address, common.BigToHash(big.NewInt(i))})
+		}
+	}
+
+	// The state of the block 10 is only on the archive node.
+	res, err := r.StorageAtMany(append(slots, slots[0]), big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(slots) {
+		t.Fatalf("TestStorageAtMany: want %v got %v", len(slots), len(res))
+	}
+	for _, slot := range slots {
+		if want := testStorage(slot.Address, slot.Slot, 10); res[slot] != want {
+			t.Fatalf("TestStorageAtMany: want %v got %v", want, res[slot])
+		}
+	}
+	if archive != int64(len(slots)) || full != 0 {
+		t.Fatalf("TestStorageAtMany: want %v got %v", []int64{int64(len(slots)), 0}, []int64{archive, full})
+	}
+
+	// Recent blocks are split over both nodes.
+	archive = 0
+
+	res, err = r.StorageAtMany(slots, big.NewInt(990))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slot := range slots {
+		if want := testStorage(slot.Address, slot.Slot, 990); res[slot] != want {
+			t.Fatalf("TestStorageAtMany: want %v got %v", want, res[slot])
+		}
+	}
+	if archive == 0 || full == 0 {
+		t.Fatalf("TestStorageAtMany: want %v got %v", "both nodes", []int64{archive, full})
+	}
+}
+
+func TestCodeAtMany(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	addresses := testAddresses(20)
+
+	codes, err := r.CodeAtMany(append(addresses, addresses[3]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != len(addresses) {
+		t.Fatalf("TestCodeAtMany: want %v got %v", len(addresses), len(codes))
+	}
+	for _, address := range addresses {
+		if !bytes.Equal(codes[address], address.Bytes()) {
+			t.Fatalf("TestCodeAtMany: want %x got %x", address.Bytes(), codes[address])
+		}
+	}
+}
+
+func TestNoncesAt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.Endpoints = []string{
+		newTestNode(t, testBackend{}, nil),
+		newTestNode(t, testBackend{}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	addresses := testAddresses(20)
+
+	nonces, err := r.NoncesAt(append(addresses, addresses[5]), big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonces) != len(addresses) {
+		t.Fatalf("TestNoncesAt: want %v got %v", len(addresses), len(nonces))
+	}
+	for i, address := range addresses {
+		if want := uint64(i + 1 + 10); nonces[address] != want {
+			t.Fatalf("TestNoncesAt: want %v got %v", want, nonces[address])
+		}
+	}
+}
+
+func TestNoncesAtShared(t *testing.T) {
+	var calls int64
+
+	slow := func(next http.Handler) http.Handler {
+		return countMethod("eth_getTransactionCount", &calls)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			next.ServeHTTP(w, r)
+		}))
+	}
+
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, slow)}
+
+	r := newTestRedgla(t, cfg)
+
+	var (
+		addresses = testAddresses(3)
+		errc      = make(chan error, 2)
+	)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			nonces, err := r.NoncesAt(addresses, big.NewInt(10))
+			if err == nil && len(nonces) != len(addresses) {
+				err = fmt.Errorf("want %v got %v", len(addresses), len(nonces))
+			}
+			errc <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("TestNoncesAtShared: want %v got %v", nil, err)
+		}
+	}
+
+	// The nonces at a fixed block are requested once.
+	if got := atomic.LoadInt64(&calls); got != 3 {
+		t.Fatalf("TestNoncesAtShared: want %v got %v", 3, got)
+	}
+}
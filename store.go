@@ -0,0 +1,276 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var errInvalidDiskCache = errors.New("invalid disk cache config")
+
+// DiskCacheConfig is the configuration of the on-disk cache of blocks
+// and receipts, which survives restarts, e.g. of a backfill job.
+type DiskCacheConfig struct {
+	// Directory of the LevelDB database. It is created if missing.
+	Path string
+
+	// Number of blocks below the head after which blocks and receipts
+	// are persisted. If zero, it is 64.
+	FinalityDepth uint64
+}
+
+func (c *DiskCacheConfig) validate() error {
+	if c.Path == "" {
+		return errInvalidDiskCache
+	}
+	return nil
+}
+
+func (c *DiskCacheConfig) finalityDepth() uint64 {
+	if c.FinalityDepth == 0 {
+		return defaultFinalityDepth
+	}
+	return c.FinalityDepth
+}
+
+var (
+	blockPrefix   = []byte("b") // blockPrefix + number (uint64 big endian) -> block
+	hashPrefix    = []byte("h") // hashPrefix + number (uint64 big endian) -> hash on the chain
+	receiptPrefix = []byte("r") // receiptPrefix + tx hash -> receipt
+)
+
+func numberKey(prefix []byte, number uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], number)
+	return key
+}
+
+func blockKey(number uint64) []byte {
+	return numberKey(blockPrefix, number)
+}
+
+// hashKey is the key of the hash of a block whose header has an
+// extension, which the RLP encoding of the block drops.
+func hashKey(number uint64) []byte {
+	return numberKey(hashPrefix, number)
+}
+
+func receiptKey(hash common.Hash) []byte {
+	return append(append([]byte(nil), receiptPrefix...), hash.Bytes()...)
+}
+
+// storedReceipt is the RLP encoding of a receipt. The consensus encoding
+// drops the fields derived from the block, so they are kept aside.
+type storedReceipt struct {
+	Receipt          []byte
+	TxHash           common.Hash
+	ContractAddress  common.Address
+	GasUsed          uint64
+	BlockHash        common.Hash
+	BlockNumber      uint64
+	TransactionIndex uint64
+	LogIndex         uint64 // Index of the first log in the block.
+}
+
+// store is the on-disk cache. A nil store is disabled; it misses every
+// lookup and ignores additions.
+type store struct {
+	db ethdb.KeyValueStore
+}
+
+func openStore(cfg *DiskCacheConfig) (*store, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	db, err := leveldb.New(cfg.Path, 16, 16, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{db}, nil
+}
+
+func (s *store) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// blocks puts the stored blocks in res and returns them along with the
+// missing numbers.
+func (s *store) blocks(numbers []uint64, res map[uint64]*types.Block) (map[uint64]*types.Block, []uint64) {
+	if s == nil {
+		return nil, numbers
+	}
+
+	var (
+		hits   = make(map[uint64]*types.Block)
+		misses = make([]uint64, 0, len(numbers))
+	)
+
+	for _, n := range numbers {
+		b, err := s.db.Get(blockKey(n))
+		if err != nil {
+			misses = append(misses, n)
+			continue
+		}
+
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(b, block); err != nil {
+			misses = append(misses, n)
+			continue
+		}
+
+		if h, err := s.db.Get(hashKey(n)); err == nil {
+			chainHashes.set(block.Hash(), common.BytesToHash(h))
+		}
+
+		hits[n] = block
+		res[n] = block
+	}
+
+	return hits, misses
+}
+
+func (s *store) putBlocks(blocks []*types.Block) error {
+	if s == nil || len(blocks) == 0 {
+		return nil
+	}
+
+	batch := s.db.NewBatch()
+	for _, block := range blocks {
+		b, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(blockKey(block.NumberU64()), b); err != nil {
+			return err
+		}
+		if hash := chainHash(block); hash != block.Hash() {
+			if err := batch.Put(hashKey(block.NumberU64()), hash.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Write()
+}
+
+// receipts puts the stored receipts in res and returns them along with
+// the transactions whose receipt is missing.
+func (s *store) receipts(txs []*types.Transaction, res map[common.Hash]*types.Receipt) (map[common.Hash]*types.Receipt, []*types.Transaction) {
+	if s == nil {
+		return nil, txs
+	}
+
+	var (
+		hits   = make(map[common.Hash]*types.Receipt)
+		misses = make([]*types.Transaction, 0, len(txs))
+	)
+
+	for _, tx := range txs {
+		b, err := s.db.Get(receiptKey(tx.Hash()))
+		if err != nil {
+			misses = append(misses, tx)
+			continue
+		}
+
+		receipt, err := decodeReceipt(b)
+		if err != nil {
+			misses = append(misses, tx)
+			continue
+		}
+
+		hits[tx.Hash()] = receipt
+		res[tx.Hash()] = receipt
+	}
+
+	return hits, misses
+}
+
+func (s *store) putReceipts(receipts map[common.Hash]*types.Receipt) error {
+	if s == nil || len(receipts) == 0 {
+		return nil
+	}
+
+	batch := s.db.NewBatch()
+	for hash, receipt := range receipts {
+		b, err := encodeReceipt(receipt)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(receiptKey(hash), b); err != nil {
+			return err
+		}
+	}
+
+	return batch.Write()
+}
+
+func encodeReceipt(receipt *types.Receipt) ([]byte, error) {
+	b, err := receipt.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := storedReceipt{
+		Receipt:          b,
+		TxHash:           receipt.TxHash,
+		ContractAddress:  receipt.ContractAddress,
+		GasUsed:          receipt.GasUsed,
+		BlockHash:        receipt.BlockHash,
+		TransactionIndex: uint64(receipt.TransactionIndex),
+	}
+
+	if receipt.BlockNumber != nil {
+		stored.BlockNumber = receipt.BlockNumber.Uint64()
+	}
+	if len(receipt.Logs) != 0 {
+		stored.LogIndex = uint64(receipt.Logs[0].Index)
+	}
+
+	return rlp.EncodeToBytes(&stored)
+}
+
+func decodeReceipt(b []byte) (*types.Receipt, error) {
+	var stored storedReceipt
+	if err := rlp.DecodeBytes(b, &stored); err != nil {
+		return nil, err
+	}
+
+	receipt := new(types.Receipt)
+	if err := receipt.UnmarshalBinary(stored.Receipt); err != nil {
+		return nil, err
+	}
+
+	receipt.TxHash = stored.TxHash
+	receipt.ContractAddress = stored.ContractAddress
+	receipt.GasUsed = stored.GasUsed
+	receipt.BlockHash = stored.BlockHash
+	receipt.BlockNumber = new(big.Int).SetUint64(stored.BlockNumber)
+	receipt.TransactionIndex = uint(stored.TransactionIndex)
+
+	for i, log := range receipt.Logs {
+		log.TxHash = stored.TxHash
+		log.TxIndex = uint(stored.TransactionIndex)
+		log.BlockHash = stored.BlockHash
+		log.BlockNumber = stored.BlockNumber
+		log.Index = uint(stored.LogIndex) + uint(i)
+	}
+
+	return receipt, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestReceiptEncoding(t *testing.T) {
+	receipt := &types.Receipt{
+		Type:              types.DynamicFeeTxType,
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 42000,
+		Logs: []*types.Log{
+			{Address: common.HexToAddress("0x01"), Topics: []common.Hash{common.HexToHash("0x02")}, Data: []byte{3}},
+			{Address: common.HexToAddress("0x04")},
+		},
+		TxHash:           common.HexToHash("0x05"),
+		GasUsed:          21000,
+		BlockHash:        common.HexToHash("0x06"),
+		BlockNumber:      big.NewInt(7),
+		TransactionIndex: 8,
+	}
+	receipt.Logs[0].Index = 9
+	receipt.Logs[1].Index = 10
+
+	b, err := encodeReceipt(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decodeReceipt(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Type != receipt.Type || got.TxHash != receipt.TxHash || got.GasUsed != receipt.GasUsed ||
+		got.BlockNumber.Cmp(receipt.BlockNumber) != 0 || got.TransactionIndex != receipt.TransactionIndex {
+		t.Fatalf("TestReceiptEncoding: want %+v got %+v", receipt, got)
+	}
+
+	if len(got.Logs) != 2 || got.Logs[1].Index != 10 || got.Logs[1].BlockNumber != 7 || got.Logs[0].Data[0] != 3 {
+		t.Fatalf("TestReceiptEncoding: want %+v got %+v", receipt.Logs, got.Logs)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	var requests int64
+
+	count := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			atomic.AddInt64(&requests, int64(strings.Count(string(body), "eth_getBlockByNumber")))
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, count)}
+	cfg.DiskCache = &DiskCacheConfig{Path: t.TempDir()}
+
+	r := newTestRedgla(t, cfg)
+	if _, err := r.BlockByRange(100, 109); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The blocks survive the restart.
+	r = newTestRedgla(t, cfg)
+	defer r.Close()
+
+	// Ignore the heartbeat.
+	atomic.StoreInt64(&requests, 0)
+
+	blocks, err := r.BlockByRange(100, 109)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, block := range blocks {
+		if block.Hash() != testHeader(n).Hash() {
+			t.Fatalf("TestDiskCache: want %v got %v", testHeader(n).Hash(), block.Hash())
+		}
+	}
+
+	if got := atomic.LoadInt64(&requests); got != 0 {
+		t.Fatalf("TestDiskCache: want %v got %v", 0, got)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var errInvalidTLS = errors.New("invalid tls config")
+
+// TLSConfig is the TLS settings of an endpoint, e.g. a private node that
+// requires client certificates signed by a private CA.
+type TLSConfig struct {
+	// PEM encoded certificates of the CAs to trust. If empty, the system
+	// roots are used.
+	CA []byte
+
+	// PEM encoded client certificate and key. Both or neither must be
+	// set.
+	Cert []byte
+	Key  []byte
+
+	// Server name to verify the certificate of the endpoint against. If
+	// empty, the host of the URL is used.
+	ServerName string
+
+	// Minimum TLS version, e.g. tls.VersionTLS13. If zero, it is TLS 1.2.
+	MinVersion uint16
+
+	once      sync.Once
+	transport *http.Transport
+	err       error
+}
+
+func (t *TLSConfig) validate() error {
+	_, err := t.tlsTransport()
+	return err
+}
+
+func (t *TLSConfig) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: t.MinVersion,
+	}
+
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if cfg.MinVersion < tls.VersionTLS10 || cfg.MinVersion > tls.VersionTLS13 {
+		return nil, fmt.Errorf("%w: unknown version %#x", errInvalidTLS, t.MinVersion)
+	}
+
+	if len(t.CA) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(t.CA) {
+			return nil, fmt.Errorf("%w: no certificate in CA", errInvalidTLS)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(t.Cert) != 0 || len(t.Key) != 0 {
+		cert, err := tls.X509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidTLS, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// tlsTransport returns the HTTP transport of the endpoint. It is created
+// once, so that connections are reused between requests.
+func (t *TLSConfig) tlsTransport() (*http.Transport, error) {
+	t.once.Do(func() {
+		cfg, err := t.config()
+		if err != nil {
+			t.err = err
+			return
+		}
+
+		t.transport = http.DefaultTransport.(*http.Transport).Clone()
+		t.transport.TLSClientConfig = cfg
+	})
+
+	return t.transport, t.err
+}
+
+func (t *TLSConfig) websocketDialer() (websocket.Dialer, error) {
+	transport, err := t.tlsTransport()
+	if err != nil {
+		return websocket.Dialer{}, err
+	}
+
+	return websocket.Dialer{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: transport.TLSClientConfig,
+	}, nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newClientCert returns a self-signed client certificate and its key.
+func newClientCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redgla"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	cert, key := newClientCert(t)
+
+	tests := []struct {
+		cfg *TLSConfig
+		err error
+	}{
+		{&TLSConfig{}, nil},
+		{&TLSConfig{CA: cert, Cert: cert, Key: key, MinVersion: tls.VersionTLS13}, nil},
+		{&TLSConfig{CA: []byte("dbadoy")}, errInvalidTLS},
+		{&TLSConfig{Cert: cert}, errInvalidTLS},
+		{&TLSConfig{MinVersion: 1}, errInvalidTLS},
+	}
+
+	for _, test := range tests {
+		if err := test.cfg.validate(); !errors.Is(err, test.err) {
+			t.Fatalf("TestTLSConfigValidation: want %v got %v", test.err, err)
+		}
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	cert, key := newClientCert(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(cert)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", testBackend{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	ts := httptest.NewUnstartedServer(server)
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	cfg := DefaultConfig()
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: ts.URL, TLS: &TLSConfig{CA: ca, Cert: cert, Key: key, ServerName: "example.com"}},
+	}
+
+	r, err := New(DefaultHeartbeatFn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Run()
+	defer r.Stop()
+
+	for i := 0; len(r.list.liveNodes()) != 1; i++ {
+		if i == 100 {
+			t.Fatal("TestMutualTLS: heartbeat failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	blocks, err := r.BlockByRange(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("TestMutualTLS: want %v got %v", 4, len(blocks))
+	}
+
+	// Without the client certificate, the node refuses.
+	node := EndpointConfig{URL: ts.URL, TLS: &TLSConfig{CA: ca}}
+	res := r.request([]EndpointConfig{node}, [2]int{0, 1}, r.fetchBlocks([]uint64{0}), nil)
+	if res.err == nil {
+		t.Fatal("TestMutualTLS: the request without a client certificate succeeded")
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const defaultTraceTimeout = 10 * time.Minute
+
+// CallTracerConfig is the configuration of the callTracer of the nodes.
+type CallTracerConfig struct {
+	// Trace only the top call of the transactions, without the calls
+	// made by the contracts.
+	OnlyTopCall bool `json:"onlyTopCall,omitempty"`
+
+	// Record the logs emitted by the calls.
+	WithLog bool `json:"withLog,omitempty"`
+}
+
+// CallFrame is a call traced by the callTracer.
+type CallFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to,omitempty"`
+	Value        *hexutil.Big    `json:"value,omitempty"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Logs         []CallLog       `json:"logs,omitempty"`
+	Calls        []CallFrame     `json:"calls,omitempty"`
+}
+
+// CallLog is a log emitted by a call, recorded if
+// CallTracerConfig.WithLog is set.
+type CallLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// TransactionTrace is the trace of a transaction of a block.
+type TransactionTrace struct {
+	// Hash of the transaction. It is zero if the node doesn't return
+	// it; the traces are in the order of the transactions anyway.
+	TxHash common.Hash `json:"txHash"`
+
+	// Top call of the transaction, nil if the tracing failed.
+	Result *CallFrame `json:"result"`
+
+	// Error of the tracing.
+	Error string `json:"error,omitempty"`
+}
+
+// traceConfig is the configuration of a trace request of the nodes.
+type traceConfig struct {
+	Tracer       string            `json:"tracer"`
+	Timeout      string            `json:"timeout"`
+	TracerConfig *CallTracerConfig `json:"tracerConfig,omitempty"`
+}
+
+// TraceBlockRange requests the call traces of the transactions of the
+// blocks in a range, keyed by the block number. The traces are requested
+// to the nodes tagged with TagDebug only, split over them if there are
+// more blocks than the Threshold. Each block is given Config.TraceTimeout
+// instead of the RequestTimeout.
+func (r *Redgla) TraceBlockRange(start uint64, end uint64, cfg *CallTracerConfig) (map[uint64][]*TransactionTrace, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		result  = make(map[uint64][]*TransactionTrace, len(numbers))
+		config  = r.traceConfig(cfg)
+	)
+
+	if len(numbers) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, _ time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[uint64][]*TransactionTrace, hi-lo)
+		err := forEachTrace(lo, hi, r.traceTimeout(), quit, func(ctx context.Context, i int) error {
+			var traces []*TransactionTrace
+			if err := client.rpc.CallContext(ctx, &traces, "debug_traceBlockByNumber", hexutil.EncodeUint64(numbers[i]), config); err != nil {
+				return err
+			}
+			res[numbers[i]] = traces
+			return nil
+		})
+		return res, err
+	}
+
+	err = r.collectTagged("debug_traceBlockByNumber", TagDebug, len(numbers), true, fn, func(m *msg) {
+		for k, v := range m.blockTraceResponse() {
+			result[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TraceTransactions requests the call traces of the transactions. It is
+// routed like TraceBlockRange.
+func (r *Redgla) TraceTransactions(hashes []common.Hash, cfg *CallTracerConfig) (map[common.Hash]*CallFrame, error) {
+	var (
+		result = make(map[common.Hash]*CallFrame, len(hashes))
+		config = r.traceConfig(cfg)
+	)
+
+	if len(hashes) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, _ time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[common.Hash]*CallFrame, hi-lo)
+		err := forEachTrace(lo, hi, r.traceTimeout(), quit, func(ctx context.Context, i int) error {
+			var frame *CallFrame
+			if err := client.rpc.CallContext(ctx, &frame, "debug_traceTransaction", hashes[i], config); err != nil {
+				return err
+			}
+			if frame == nil {
+				return fmt.Errorf("transaction %s not found", hashes[i])
+			}
+			res[hashes[i]] = frame
+			return nil
+		})
+		return res, err
+	}
+
+	err := r.collectTagged("debug_traceTransaction", TagDebug, len(hashes), true, fn, func(m *msg) {
+		for k, v := range m.transactionTraceResponse() {
+			result[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *Redgla) traceTimeout() time.Duration {
+	if r.cfg.TraceTimeout == 0 {
+		return defaultTraceTimeout
+	}
+	return r.cfg.TraceTimeout
+}
+
+func (r *Redgla) traceConfig(cfg *CallTracerConfig) *traceConfig {
+	return &traceConfig{
+		Tracer:       "callTracer",
+		Timeout:      r.traceTimeout().String(),
+		TracerConfig: cfg,
+	}
+}
+
+// forEachTrace is forEach giving each item its own timeout.
+func forEachTrace(lo int, hi int, timeout time.Duration, quit chan struct{}, fn func(ctx context.Context, i int) error) error {
+	return forEach(context.Background(), lo, hi, time.Duration(hi-lo)*timeout, quit, func(ctx context.Context, i int) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return fn(ctx, i)
+	})
+}
+
+// Trace is a trace of trace_filter, in the format of OpenEthereum.
+type Trace struct {
+	Action              TraceAction  `json:"action"`
+	Result              *TraceResult `json:"result"`
+	Error               string       `json:"error,omitempty"`
+	BlockHash           common.Hash  `json:"blockHash"`
+	BlockNumber         uint64       `json:"blockNumber"`
+	Subtraces           int          `json:"subtraces"`
+	TraceAddress        []int        `json:"traceAddress"`
+	TransactionHash     *common.Hash `json:"transactionHash"`
+	TransactionPosition *uint64      `json:"transactionPosition"`
+
+	// One of "call", "create", "suicide" and "reward".
+	Type string `json:"type"`
+}
+
+// TraceAction is the action of a Trace. The fields set depend on the
+// type of the trace.
+type TraceAction struct {
+	CallType      string          `json:"callType,omitempty"`
+	From          *common.Address `json:"from,omitempty"`
+	To            *common.Address `json:"to,omitempty"`
+	Gas           hexutil.Uint64  `json:"gas,omitempty"`
+	Input         hexutil.Bytes   `json:"input,omitempty"`
+	Init          hexutil.Bytes   `json:"init,omitempty"`
+	Value         *hexutil.Big    `json:"value,omitempty"`
+	Address       *common.Address `json:"address,omitempty"`
+	RefundAddress *common.Address `json:"refundAddress,omitempty"`
+	Balance       *hexutil.Big    `json:"balance,omitempty"`
+	Author        *common.Address `json:"author,omitempty"`
+	RewardType    string          `json:"rewardType,omitempty"`
+}
+
+// TraceResult is the result of a Trace. Address and Code are set for
+// the creations only.
+type TraceResult struct {
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Output  hexutil.Bytes   `json:"output,omitempty"`
+	Address *common.Address `json:"address,omitempty"`
+	Code    hexutil.Bytes   `json:"code,omitempty"`
+}
+
+// TraceFilterQuery selects the traces of TraceFilter by their addresses.
+// Empty lists match every address.
+type TraceFilterQuery struct {
+	FromAddress []common.Address
+	ToAddress   []common.Address
+}
+
+// Messages of the errors of the nodes and providers refusing a request
+// as too large.
+var oversizeErrors = []string{
+	"response size exceeded",
+	"response size is larger",
+	"response too large",
+	"response is too large",
+	"response is too big",
+	"range too large",
+	"range is too large",
+	"exceed maximum block range",
+	"exceeds maximum block range",
+	"query returned more than",
+}
+
+// traceFilter is the filter of trace_filter.
+type traceFilter struct {
+	FromBlock   hexutil.Uint64   `json:"fromBlock"`
+	ToBlock     hexutil.Uint64   `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress,omitempty"`
+	ToAddress   []common.Address `json:"toAddress,omitempty"`
+}
+
+// TraceFilter requests the traces of the blocks in a range matching the
+// query, keyed by their transaction hash. The block rewards, which have
+// no transaction, are keyed by the zero hash.
+//
+// The traces are requested to the nodes tagged with TagTrace only, split
+// over them if there are more blocks than the Threshold. A range the
+// node refuses as too large is bisected until it is accepted, or until
+// it is a single block. Each request is given Config.TraceTimeout
+// instead of the RequestTimeout.
+func (r *Redgla) TraceFilter(start uint64, end uint64, query *TraceFilterQuery) (map[common.Hash][]*Trace, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	if query == nil {
+		query = &TraceFilterQuery{}
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		blocks  = make(map[uint64][]*Trace, len(numbers))
+	)
+
+	if len(numbers) != 0 {
+		fn := func(client *conn, _ time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+			res := make(map[uint64][]*Trace, hi-lo)
+			err := r.traceFilter(client, numbers[lo], numbers[hi-1], query, quit, res)
+			return res, err
+		}
+
+		err = r.collectTagged("trace_filter", TagTrace, len(numbers), true, fn, func(m *msg) {
+			for k, v := range m.filterTraceResponse() {
+				blocks[k] = v
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The traces of a transaction are in a single block, only the
+	// rewards are spread over the blocks.
+	result := make(map[common.Hash][]*Trace)
+	for _, n := range numbers {
+		for _, trace := range blocks[n] {
+			var hash common.Hash
+			if trace.TransactionHash != nil {
+				hash = *trace.TransactionHash
+			}
+			result[hash] = append(result[hash], trace)
+		}
+	}
+
+	return result, nil
+}
+
+// TraceBlocks requests the traces of the blocks in a range with
+// trace_block, keyed by the block number. It is routed like TraceFilter,
+// one block per request.
+func (r *Redgla) TraceBlocks(start uint64, end uint64) (map[uint64][]*Trace, error) {
+	end, err := r.clamp(end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		numbers = makeRange(start, end)
+		result  = make(map[uint64][]*Trace, len(numbers))
+	)
+
+	if len(numbers) == 0 {
+		return result, nil
+	}
+
+	fn := func(client *conn, _ time.Duration, lo int, hi int, quit chan struct{}) (interface{}, error) {
+		res := make(map[uint64][]*Trace, hi-lo)
+		err := forEachTrace(lo, hi, r.traceTimeout(), quit, func(ctx context.Context, i int) error {
+			var traces []*Trace
+			if err := client.rpc.CallContext(ctx, &traces, "trace_block", hexutil.EncodeUint64(numbers[i])); err != nil {
+				return err
+			}
+			for _, trace := range traces {
+				if trace.BlockNumber != numbers[i] {
+					return fmt.Errorf("trace of block %d returned for block %d", trace.BlockNumber, numbers[i])
+				}
+			}
+			res[numbers[i]] = traces
+			return nil
+		})
+		return res, err
+	}
+
+	err = r.collectTagged("trace_block", TagTrace, len(numbers), true, fn, func(m *msg) {
+		for k, v := range m.filterTraceResponse() {
+			result[k] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// traceFilter requests the traces of the blocks [from, to] into res,
+// keyed by the block number, bisecting the range if it's too large for
+// the node.
+func (r *Redgla) traceFilter(client *conn, from uint64, to uint64, query *TraceFilterQuery, quit chan struct{}, res map[uint64][]*Trace) error {
+	select {
+	case _, ok := <-quit:
+		if !ok {
+			return ErrBatchFailure
+		}
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.traceTimeout())
+	defer cancel()
+
+	var traces []*Trace
+	err := client.rpc.CallContext(ctx, &traces, "trace_filter", traceFilter{
+		FromBlock:   hexutil.Uint64(from),
+		ToBlock:     hexutil.Uint64(to),
+		FromAddress: query.FromAddress,
+		ToAddress:   query.ToAddress,
+	})
+	if err != nil {
+		if from == to || !isOversized(err) {
+			return err
+		}
+
+		mid := from + (to-from)/2
+		if err := r.traceFilter(client, from, mid, query, quit, res); err != nil {
+			return err
+		}
+		return r.traceFilter(client, mid+1, to, query, quit, res)
+	}
+
+	for _, trace := range traces {
+		if trace.BlockNumber < from || trace.BlockNumber > to {
+			return fmt.Errorf("trace of block %d returned for blocks %d-%d", trace.BlockNumber, from, to)
+		}
+		res[trace.BlockNumber] = append(res[trace.BlockNumber], trace)
+	}
+
+	return nil
+}
+
+// isOversized reports whether the node refused a request because its
+// range or response is too large. Only the known errors of the nodes and
+// providers count; throttling and timeouts must not cause bisection,
+// which would only multiply the requests.
+func isOversized(err error) bool {
+	if isRateLimited(err) || errors.Is(err, ErrQuotaExhausted) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range oversizeErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	return false
+}
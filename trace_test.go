@@ -0,0 +1,252 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testDebugBackend traces two transactions in every block, from the
+// address of the block number.
+type testDebugBackend struct{}
+
+func (testDebugBackend) TraceBlockByNumber(number rpc.BlockNumber, cfg *traceConfig) ([]*TransactionTrace, error) {
+	if err := testCheckTraceConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	from := common.BigToAddress(big.NewInt(int64(number)))
+	return []*TransactionTrace{
+		{Result: &CallFrame{Type: "CALL", From: from, GasUsed: hexutil.Uint64(number)}},
+		{Result: &CallFrame{Type: "CREATE", From: from, GasUsed: hexutil.Uint64(number)}},
+	}, nil
+}
+
+func (testDebugBackend) TraceTransaction(hash common.Hash, cfg *traceConfig) (*CallFrame, error) {
+	if err := testCheckTraceConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return &CallFrame{
+		Type:  "CALL",
+		Input: hash.Bytes(),
+		Calls: []CallFrame{{Type: "STATICCALL", Input: hash.Bytes()}},
+	}, nil
+}
+
+func testCheckTraceConfig(cfg *traceConfig) error {
+	if cfg.Tracer != "callTracer" || cfg.Timeout != "10m0s" || cfg.TracerConfig == nil || !cfg.TracerConfig.OnlyTopCall {
+		return fmt.Errorf("unexpected trace config %+v", cfg)
+	}
+	return nil
+}
+
+func TestTraceBlockRange(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "debug": testDebugBackend{}}, nil), Tags: []string{TagDebug}},
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "debug": testDebugBackend{}}, nil), Tags: []string{TagDebug}},
+		// Traces fail on this node.
+		{URL: newTestNode(t, testBackend{}, nil)},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.TraceBlockRange(1, 20, &CallTracerConfig{OnlyTopCall: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 20 {
+		t.Fatalf("TestTraceBlockRange: want %v got %v", 20, len(res))
+	}
+	for n, traces := range res {
+		if len(traces) != 2 || uint64(traces[1].Result.GasUsed) != n || traces[1].Result.Type != "CREATE" {
+			t.Fatalf("TestTraceBlockRange: want %v got %+v", n, traces)
+		}
+	}
+}
+
+func TestTraceTransactions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Threshold = 1
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "debug": testDebugBackend{}}, nil), Tags: []string{TagDebug}},
+		{URL: newTestNode(t, testBackend{}, nil)},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	hashes := []common.Hash{{1}, {2}, {3}}
+
+	res, err := r.TraceTransactions(hashes, &CallTracerConfig{OnlyTopCall: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		frame := res[hash]
+		if frame == nil || common.BytesToHash(frame.Calls[0].Input) != hash {
+			t.Fatalf("TestTraceTransactions: want %v got %+v", hash, frame)
+		}
+	}
+}
+
+func TestTraceWithoutDebugNode(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Endpoints = []string{newTestNode(t, testBackend{}, nil)}
+
+	r := newTestRedgla(t, cfg)
+
+	if _, err := r.TraceTransactions([]common.Hash{{1}}, nil); !errors.Is(err, ErrNoAliveNode) {
+		t.Fatalf("TestTraceWithoutDebugNode: want %v got %v", ErrNoAliveNode, err)
+	}
+}
+
+// testTraceBackend traces a transaction and the reward of every block,
+// refusing the ranges of more than 4 blocks. If limited is set, it
+// refuses every request as a provider over its rate limit does.
+type testTraceBackend struct {
+	calls   *int64
+	limited bool
+}
+
+func (b testTraceBackend) Filter(filter traceFilter) ([]*Trace, error) {
+	atomic.AddInt64(b.calls, 1)
+
+	if b.limited {
+		return nil, errors.New("daily request count exceeded, request rate limited")
+	}
+	if filter.ToBlock-filter.FromBlock+1 > 4 {
+		return nil, errors.New("block range too large")
+	}
+
+	var res []*Trace
+	for n := uint64(filter.FromBlock); n <= uint64(filter.ToBlock); n++ {
+		res = append(res, testTraces(n, filter.ToAddress[0])...)
+	}
+
+	return res, nil
+}
+
+func (b testTraceBackend) Block(number hexutil.Uint64) ([]*Trace, error) {
+	atomic.AddInt64(b.calls, 1)
+	return testTraces(uint64(number), common.HexToAddress("0x01")), nil
+}
+
+func testTraces(n uint64, to common.Address) []*Trace {
+	hash := testHash(n)
+	return []*Trace{
+		{BlockNumber: n, TransactionHash: &hash, Type: "call", Action: TraceAction{CallType: "call", To: &to}},
+		{BlockNumber: n, Type: "reward", Action: TraceAction{RewardType: "block"}},
+	}
+}
+
+func TestTraceFilter(t *testing.T) {
+	var calls int64
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "trace": testTraceBackend{calls: &calls}}, nil), Tags: []string{TagTrace}},
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "trace": testTraceBackend{calls: &calls}}, nil), Tags: []string{TagTrace}},
+		// Traces fail on this node.
+		{URL: newTestNode(t, testBackend{}, nil)},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	to := common.HexToAddress("0x01")
+
+	res, err := r.TraceFilter(1, 20, &TraceFilterQuery{ToAddress: []common.Address{to}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 21 {
+		t.Fatalf("TestTraceFilter: want %v got %v", 21, len(res))
+	}
+	for n := uint64(1); n <= 20; n++ {
+		traces := res[testHash(n)]
+		if len(traces) != 1 || traces[0].BlockNumber != n || *traces[0].Action.To != to {
+			t.Fatalf("TestTraceFilter: want %v got %+v", n, traces)
+		}
+	}
+
+	// The rewards are in the order of the blocks.
+	rewards := res[common.Hash{}]
+	if len(rewards) != 20 {
+		t.Fatalf("TestTraceFilter: want %v got %v", 20, len(rewards))
+	}
+	for i, trace := range rewards {
+		if trace.BlockNumber != uint64(i+1) {
+			t.Fatalf("TestTraceFilter: want %v got %v", i+1, trace.BlockNumber)
+		}
+	}
+
+	// Parts of 11 and 9 blocks, refused and bisected into parts of at
+	// most 4 blocks: 11 into 6 and 5, both refused and bisected again,
+	// 9 into 5, refused and bisected again, and 4.
+	if want := int64(7 + 5); atomic.LoadInt64(&calls) != want {
+		t.Fatalf("TestTraceFilter: want %v got %v", want, atomic.LoadInt64(&calls))
+	}
+}
+
+func TestTraceFilterRateLimited(t *testing.T) {
+	var calls int64
+
+	cfg := DefaultConfig()
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "trace": testTraceBackend{&calls, true}}, nil), Tags: []string{TagTrace}},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Throttling isn't taken for a range too large.
+	if _, err := r.TraceFilter(1, 20, &TraceFilterQuery{ToAddress: []common.Address{{1}}}); err == nil {
+		t.Fatal("TestTraceFilterRateLimited: rate limited request succeeded")
+	}
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Fatalf("TestTraceFilterRateLimited: want %v got %v", 1, got)
+	}
+}
+
+func TestTraceBlocks(t *testing.T) {
+	var calls int64
+
+	cfg := DefaultConfig()
+	cfg.Threshold = 5
+	cfg.EndpointConfigs = []EndpointConfig{
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "trace": testTraceBackend{calls: &calls}}, nil), Tags: []string{TagTrace}},
+		{URL: newTestServer(t, map[string]interface{}{"eth": testBackend{}, "trace": testTraceBackend{calls: &calls}}, nil), Tags: []string{TagTrace}},
+		{URL: newTestNode(t, testBackend{}, nil)},
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res, err := r.TraceBlocks(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 10 {
+		t.Fatalf("TestTraceBlocks: want %v got %v", 10, len(res))
+	}
+	for n := uint64(1); n <= 10; n++ {
+		if traces := res[n]; len(traces) != 2 || *traces[0].TransactionHash != testHash(n) {
+			t.Fatalf("TestTraceBlocks: want %v got %+v", n, traces)
+		}
+	}
+
+	if got := atomic.LoadInt64(&calls); got != 10 {
+		t.Fatalf("TestTraceBlocks: want %v got %v", 10, got)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// transport is the http.RoundTripper of the requests sent to an
+// endpoint. It applies the rate limit and quota of the endpoint, and
+// backs the endpoint off when it answers 429.
+type transport struct {
+	base     http.RoundTripper
+	endpoint string
+
+	throttle *throttle
+	quotas   *quotas
+}
+
+func (r *Redgla) httpClient(node EndpointConfig) *http.Client {
+	return &http.Client{
+		Transport: &transport{
+			base:     node.roundTripper(),
+			endpoint: node.URL,
+			throttle: r.throttle,
+			quotas:   r.quotas,
+		},
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := t.quotas.charge(t.endpoint, requestMethods(body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := t.throttle.wait(req.Context(), t.endpoint); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.throttle.backoff(t.endpoint, parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Period a node returning inconsistent data is considered unhealthy.
+const unhealthyPeriod = time.Minute
+
+// ErrInvalidData is returned if no node returns data consistent with its
+// header, see Config.Verify and ProofsAt.
+var ErrInvalidData = errors.New("inconsistent data")
+
+// verify checks the response of a request against the headers of the
+// blocks. Blocks must match their transaction and uncle roots; receipts
+// must match the receipt root of their block, which requests the block
+// and the receipts of all its transactions.
+//
+// Blocks requested by number are also checked against the hash the node
+// reports for them, see blockWithHash. The withdrawals aren't returned
+// by the client, so they aren't checked.
+func verify(client *conn, timeout time.Duration, v interface{}) error {
+	switch v := v.(type) {
+	case map[uint64]*types.Block:
+		for n, block := range v {
+			if block.NumberU64() != n {
+				return fmt.Errorf("%w: block %d returned for %d", ErrInvalidData, block.NumberU64(), n)
+			}
+			if err := verifyBlock(block); err != nil {
+				return err
+			}
+		}
+
+	case map[common.Hash]*types.Transaction:
+		for hash, tx := range v {
+			if tx.Hash() != hash {
+				return fmt.Errorf("%w: transaction %s returned for %s", ErrInvalidData, tx.Hash(), hash)
+			}
+		}
+
+	case map[common.Hash]*types.Receipt:
+		return verifyReceipts(client, timeout, v)
+	}
+
+	return nil
+}
+
+// getBlock requests the block like ethclient.Client.BlockByNumber and
+// BlockByHash, given the method and its first argument. The hash of the
+// block on the chain is computed from all the fields of its header, see
+// chainHash. If verify is set, the block fails with ErrInvalidData unless
+// its hash is the one the node reports, and so are those of its uncles.
+func getBlock(ctx context.Context, client *conn, method string, arg interface{}, verify bool) (*types.Block, error) {
+	var raw json.RawMessage
+	if err := client.rpc.CallContext(ctx, &raw, method, arg, true); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+
+	var body struct {
+		Hash         common.Hash          `json:"hash"`
+		Transactions []*types.Transaction `json:"transactions"`
+		Uncles       []common.Hash        `json:"uncles"`
+	}
+
+	header, hash, err := decodeHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	if verify && hash != body.Hash {
+		return nil, fmt.Errorf("%w: header hash of block %d", ErrInvalidData, header.Number)
+	}
+
+	// The uncles aren't in the response.
+	uncles := make([]*types.Header, len(body.Uncles))
+	if len(uncles) != 0 {
+		batch := make([]rpc.BatchElem, len(uncles))
+		for i := range batch {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getUncleByBlockHashAndIndex",
+				Args:   []interface{}{body.Hash, hexutil.EncodeUint64(uint64(i))},
+				Result: &uncles[i],
+			}
+		}
+
+		if err := client.rpc.BatchCallContext(ctx, batch); err != nil {
+			return nil, err
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return nil, elem.Error
+			}
+			if uncles[i] == nil {
+				return nil, fmt.Errorf("uncle %d of block %d not found", i, header.Number)
+			}
+			if verify && uncles[i].Hash() != body.Uncles[i] {
+				return nil, fmt.Errorf("%w: uncle %d of block %d", ErrInvalidData, i, header.Number)
+			}
+		}
+	}
+
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions, uncles), nil
+}
+
+func verifyBlock(block *types.Block) error {
+	if root := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); root != block.TxHash() {
+		return fmt.Errorf("%w: transaction root of block %d", ErrInvalidData, block.NumberU64())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return fmt.Errorf("%w: uncle hash of block %d", ErrInvalidData, block.NumberU64())
+	}
+	return nil
+}
+
+func verifyReceipts(client *conn, timeout time.Duration, receipts map[common.Hash]*types.Receipt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	blocks := make(map[common.Hash]bool)
+	for hash, receipt := range receipts {
+		if receipt.TxHash != hash {
+			return fmt.Errorf("%w: receipt of %s returned for %s", ErrInvalidData, receipt.TxHash, hash)
+		}
+		blocks[receipt.BlockHash] = true
+	}
+
+	for hash := range blocks {
+		block, err := getBlock(ctx, client, "eth_getBlockByHash", hash, true)
+		if err != nil {
+			return err
+		}
+		if chainHash(block) != hash {
+			return fmt.Errorf("%w: header hash of block %s", ErrInvalidData, hash)
+		}
+		if err := verifyBlock(block); err != nil {
+			return err
+		}
+
+		list := make(types.Receipts, 0, len(block.Transactions()))
+		for _, tx := range block.Transactions() {
+			receipt, ok := receipts[tx.Hash()]
+			if !ok {
+				if receipt, err = client.TransactionReceipt(ctx, tx.Hash()); err != nil {
+					return err
+				}
+			}
+
+			if receipt.BlockHash != hash || receipt.BlockNumber == nil || receipt.BlockNumber.Uint64() != block.NumberU64() {
+				return fmt.Errorf("%w: receipt of %s is not in block %s", ErrInvalidData, tx.Hash(), hash)
+			}
+			list = append(list, receipt)
+		}
+
+		// Every receipt claiming the block must be one of them.
+		for txHash, receipt := range receipts {
+			if receipt.BlockHash == hash && block.Transaction(txHash) == nil {
+				return fmt.Errorf("%w: receipt of %s is not in block %s", ErrInvalidData, txHash, hash)
+			}
+		}
+
+		if root := types.DeriveSha(list, trie.NewStackTrie(nil)); root != block.ReceiptHash() {
+			return fmt.Errorf("%w: receipt root of block %d", ErrInvalidData, block.NumberU64())
+		}
+	}
+
+	return nil
+}
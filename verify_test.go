@@ -0,0 +1,146 @@
+// Copyright (c) 2023, redgla authors <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package redgla
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+func testTransaction(t *testing.T) *types.Transaction {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// testVerifyBackend serves blocks of a single transaction. If corrupt is
+// set, the transaction root of the headers doesn't match it; if forged
+// is set, the hash reported for the headers isn't theirs.
+type testVerifyBackend struct {
+	testBackend
+	tx      *types.Transaction
+	corrupt bool
+	forged  bool
+}
+
+func (b testVerifyBackend) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	txs := types.Transactions{b.tx}
+
+	header := testHeader(testNumber(number))
+	header.TxHash = types.DeriveSha(txs, trie.NewStackTrie(nil))
+	if b.corrupt {
+		header.TxHash = types.DeriveSha(append(txs, b.tx), trie.NewStackTrie(nil))
+	}
+
+	res, err := marshalBlock(header)
+	if err != nil {
+		return nil, err
+	}
+	res["transactions"] = txs
+	if b.forged {
+		res["hash"] = common.Hash{1}
+	}
+
+	return res, nil
+}
+
+func TestVerifyBlock(t *testing.T) {
+	tx := testTransaction(t)
+
+	header := testHeader(1)
+	header.TxHash = types.DeriveSha(types.Transactions{tx}, trie.NewStackTrie(nil))
+
+	block := types.NewBlockWithHeader(header).WithBody(types.Transactions{tx}, nil)
+	if err := verifyBlock(block); err != nil {
+		t.Fatalf("TestVerifyBlock: want %v got %v", nil, err)
+	}
+
+	block = types.NewBlockWithHeader(header).WithBody(types.Transactions{tx, tx}, nil)
+	if err := verifyBlock(block); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("TestVerifyBlock: want %v got %v", ErrInvalidData, err)
+	}
+
+	if err := verify(nil, 0, map[uint64]*types.Block{2: block}); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("TestVerifyBlock: want %v got %v", ErrInvalidData, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tx := testTransaction(t)
+
+	cfg := DefaultConfig()
+	cfg.Verify = true
+	cfg.Endpoints = []string{
+		newTestNode(t, testVerifyBackend{tx: tx, corrupt: true}, nil),
+		newTestNode(t, testVerifyBackend{tx: tx}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	// Whichever node is asked first, the data of the corrupt node is
+	// rejected.
+	for i := 0; i < 5; i++ {
+		blocks, err := r.BlockByRange(10, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			if err := verifyBlock(block); err != nil {
+				t.Fatalf("TestVerify: want %v got %v", nil, err)
+			}
+		}
+	}
+
+	res := r.requestTo(r.endpoint(cfg.Endpoints[0]), [2]int{0, 1}, r.fetchBlocks([]uint64{10}), nil)
+	if !errors.Is(res.err, ErrInvalidData) {
+		t.Fatalf("TestVerify: want %v got %v", ErrInvalidData, res.err)
+	}
+	if !r.throttle.throttled(cfg.Endpoints[0]) {
+		t.Fatal("TestVerify: the corrupt node is not marked unhealthy")
+	}
+}
+
+func TestVerifyHeaderHash(t *testing.T) {
+	tx := testTransaction(t)
+
+	cfg := DefaultConfig()
+	cfg.Verify = true
+	cfg.Endpoints = []string{
+		newTestNode(t, testVerifyBackend{tx: tx, forged: true}, nil),
+		newTestNode(t, testVerifyBackend{tx: tx}, nil),
+	}
+
+	r := newTestRedgla(t, cfg)
+
+	res := r.requestTo(r.endpoint(cfg.Endpoints[0]), [2]int{0, 1}, r.fetchBlocks([]uint64{10}), nil)
+	if !errors.Is(res.err, ErrInvalidData) {
+		t.Fatalf("TestVerifyHeaderHash: want %v got %v", ErrInvalidData, res.err)
+	}
+
+	// The forged node is left out.
+	blocks, err := r.BlockByRange(10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 11 {
+		t.Fatalf("TestVerifyHeaderHash: want %v got %v", 11, len(blocks))
+	}
+}